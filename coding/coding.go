@@ -0,0 +1,203 @@
+// Package coding selects the data_coding of a message text and computes
+// how it is split into the parts of a concatenated message.
+package coding
+
+import (
+	"strings"
+
+	"github.com/skill215/go-smpp/smpp/pdu/pdutext"
+)
+
+// data_coding values of the texts the generator sends.
+const (
+	GSM7   = pdutext.DefaultType
+	Latin1 = pdutext.Latin1Type
+	Binary = pdutext.Binary2Type
+	UCS2   = pdutext.UCS2Type
+)
+
+// lengths of a user data header with a concatenation IE with an 8 bit
+// reference, the usual one, and with a 16 bit reference
+const (
+	UDHConcat8  = 6
+	UDHConcat16 = 7
+)
+
+// Select returns the cheapest data coding that takes every character of
+// s: GSM7 for the default alphabet with its extension table, Latin1 when
+// every character is in ISO-8859-1 and UCS2 otherwise.
+func Select(s string) pdutext.DataCoding {
+	if IsGSM7(s) {
+		return GSM7
+	}
+	for _, r := range s {
+		if r > 0xFF {
+			return UCS2
+		}
+	}
+	return Latin1
+}
+
+// ToLatin1 replaces the characters of s outside of ISO-8859-1 with '?'.
+func ToLatin1(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r > 0xFF {
+			return '?'
+		}
+		return r
+	}, s)
+}
+
+// Parse returns the data coding named by s, auto and the empty string
+// return false.
+func Parse(s string) (pdutext.DataCoding, bool) {
+	switch strings.ToLower(s) {
+	case "gsm7":
+		return GSM7, true
+	case "latin1":
+		return Latin1, true
+	case "binary":
+		return Binary, true
+	case "ucs2":
+		return UCS2, true
+	}
+	return 0, false
+}
+
+// Name returns the name of a data coding as accepted by Parse.
+func Name(dcs pdutext.DataCoding) string {
+	switch dcs {
+	case GSM7:
+		return "gsm7"
+	case Latin1:
+		return "latin1"
+	case Binary:
+		return "binary"
+	case UCS2:
+		return "ucs2"
+	}
+	return "unknown"
+}
+
+// unit is the width of a character in the units of a data coding, which
+// are septets, octets or UTF-16 code units. A character is never split
+// between two parts.
+func unit(dcs pdutext.DataCoding, r rune) int {
+	switch dcs {
+	case GSM7:
+		if c := defaultTable.septets(r); c > 0 {
+			return c
+		}
+		return 1
+	case UCS2:
+		// a surrogate pair outside of the basic multilingual plane
+		if r > 0xFFFF {
+			return 2
+		}
+		return 1
+	}
+	return 1
+}
+
+// Capacity returns the units of a data coding that fit a short message
+// of 140 octets after a user data header of udhLen octets.
+func Capacity(dcs pdutext.DataCoding, udhLen int) int {
+	octets := 140 - udhLen
+	switch dcs {
+	case GSM7:
+		if udhLen == 0 {
+			return 160
+		}
+		// the header is padded to a septet boundary
+		return (octets*8 - (7-(udhLen*8)%7)%7) / 7
+	case UCS2:
+		return octets / 2
+	}
+	return octets
+}
+
+// Length returns the length of s in the units of a data coding.
+func Length(s string, dcs pdutext.DataCoding) int {
+	if dcs == Binary {
+		return len(s)
+	}
+	n := 0
+	for _, r := range s {
+		n += unit(dcs, r)
+	}
+	return n
+}
+
+// Parts splits s into the texts of the parts it takes with a data coding
+// when every part carries a user data header of udhLen octets. A text that
+// fits a single short message is one part.
+func Parts(s string, dcs pdutext.DataCoding, udhLen int) []string {
+	if Length(s, dcs) <= Capacity(dcs, 0) {
+		return []string{s}
+	}
+	capacity := Capacity(dcs, udhLen)
+	parts := []string{}
+	if dcs == Binary {
+		for len(s) > capacity {
+			parts = append(parts, s[:capacity])
+			s = s[capacity:]
+		}
+		return append(parts, s)
+	}
+	start, used := 0, 0
+	for i, r := range s {
+		w := unit(dcs, r)
+		if used+w > capacity {
+			parts = append(parts, s[start:i])
+			start, used = i, 0
+		}
+		used += w
+	}
+	return append(parts, s[start:])
+}
+
+// Fits reports whether the encoded text of a data coding fits a single
+// short message after a user data header of udhLen octets.
+func Fits(dcs pdutext.DataCoding, raw []byte, udhLen int) bool {
+	return len(raw) <= octets(dcs, udhLen)
+}
+
+// octets returns the octets of encoded text of a data coding that fit a
+// short message after a user data header of udhLen octets. GSM7 texts are
+// encoded a septet per octet.
+func octets(dcs pdutext.DataCoding, udhLen int) int {
+	if dcs == UCS2 {
+		return Capacity(dcs, udhLen) * 2
+	}
+	return Capacity(dcs, udhLen)
+}
+
+// Split splits the encoded text of a data coding into parts that fit a
+// short message after a user data header of udhLen octets. An escape and
+// its septet and a surrogate pair stay in the same part.
+func Split(dcs pdutext.DataCoding, raw []byte, udhLen int) [][]byte {
+	capacity := octets(dcs, udhLen)
+	parts := [][]byte{}
+	for len(raw) > capacity {
+		n := capacity
+		switch dcs {
+		case GSM7:
+			if raw[n-1] == escape {
+				n--
+			}
+		case UCS2:
+			if raw[n-2] >= 0xD8 && raw[n-2] <= 0xDB {
+				n -= 2
+			}
+		}
+		parts = append(parts, raw[:n])
+		raw = raw[n:]
+	}
+	return append(parts, raw)
+}
+
+// Segments returns the number of parts s takes with a data coding and the
+// usual concatenation header.
+func Segments(s string, dcs pdutext.DataCoding) int {
+	return len(Parts(s, dcs, UDHConcat8))
+}
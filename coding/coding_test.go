@@ -0,0 +1,106 @@
+package coding
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/skill215/go-smpp/smpp/pdu/pdutext"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelect(t *testing.T) {
+	assert.Equal(t, GSM7, Select("Hello {world} [1] ~ € ^ |"))
+	assert.Equal(t, GSM7, Select("Æøå ÄÖÜ ß é"))
+	// backtick and ê are not in the GSM 03.38 alphabet
+	assert.Equal(t, Latin1, Select("`code`"))
+	assert.Equal(t, Latin1, Select("crème brûlée"))
+	assert.Equal(t, UCS2, Select("你好"))
+	assert.Equal(t, UCS2, Select("price 5€ `x`"))
+	assert.Equal(t, UCS2, Select("😀"))
+}
+
+func TestLength(t *testing.T) {
+	assert.Equal(t, 5, Length("hello", GSM7))
+	// escape and septet for every extension character
+	assert.Equal(t, 8, Length("{€}[", GSM7))
+	assert.Equal(t, 3, Length("añb", Latin1))
+	assert.Equal(t, 4, Length("你好😀", UCS2))
+}
+
+func TestCapacity(t *testing.T) {
+	assert.Equal(t, 160, Capacity(GSM7, 0))
+	assert.Equal(t, 153, Capacity(GSM7, UDHConcat8))
+	assert.Equal(t, 152, Capacity(GSM7, 7))
+	assert.Equal(t, 140, Capacity(Latin1, 0))
+	assert.Equal(t, 134, Capacity(Latin1, UDHConcat8))
+	assert.Equal(t, 70, Capacity(UCS2, 0))
+	assert.Equal(t, 67, Capacity(UCS2, UDHConcat8))
+}
+
+func TestSegments(t *testing.T) {
+	for _, c := range []struct {
+		text  string
+		dcs   byte
+		parts int
+	}{
+		{strings.Repeat("a", 160), 0, 1},
+		{strings.Repeat("a", 161), 0, 2},
+		{strings.Repeat("a", 306), 0, 2},
+		{strings.Repeat("a", 307), 0, 3},
+		// 80 extension characters are 160 septets
+		{strings.Repeat("€", 80), 0, 1},
+		{strings.Repeat("€", 81), 0, 2},
+		{strings.Repeat("好", 70), 8, 1},
+		{strings.Repeat("好", 71), 8, 2},
+		{strings.Repeat("好", 134), 8, 2},
+		{strings.Repeat("好", 135), 8, 3},
+		{strings.Repeat("é", 140), 3, 1},
+		{strings.Repeat("é", 141), 3, 2},
+	} {
+		assert.Equal(t, c.parts, Segments(c.text, pdutext.DataCoding(c.dcs)), "%d x %q", Length(c.text, pdutext.DataCoding(c.dcs)), c.text[:3])
+	}
+}
+
+func TestPartsKeepEscapes(t *testing.T) {
+	// 152 septets, then an extension character that does not fit the part
+	text := strings.Repeat("a", 152) + "€" + strings.Repeat("b", 10)
+	parts := Parts(text, GSM7, UDHConcat8)
+	assert.Equal(t, []string{strings.Repeat("a", 152), "€" + strings.Repeat("b", 10)}, parts)
+	// a surrogate pair is not split either
+	text = strings.Repeat("好", 66) + "😀" + "xxxxx"
+	parts = Parts(text, UCS2, UDHConcat8)
+	assert.Equal(t, []string{strings.Repeat("好", 66), "😀xxxxx"}, parts)
+}
+
+func TestSplit(t *testing.T) {
+	raw := pdutext.GSM7(strings.Repeat("a", 160)).Encode()
+	assert.True(t, Fits(GSM7, raw, 0))
+	assert.False(t, Fits(GSM7, raw, UDHConcat8))
+	parts := Split(GSM7, raw, UDHConcat8)
+	assert.Equal(t, 2, len(parts))
+	assert.Equal(t, 153, len(parts[0]))
+
+	// an escape is not split from its septet
+	raw = pdutext.GSM7(strings.Repeat("a", 152) + "€b").Encode()
+	parts = Split(GSM7, raw, UDHConcat8)
+	assert.Equal(t, 152, len(parts[0]))
+	assert.Equal(t, []byte{escape, 0x65, 'b'}, parts[1])
+
+	// 67 characters of UCS2 per part, a surrogate pair is not split
+	raw = pdutext.UCS2(strings.Repeat("好", 66) + "😀xxxxx").Encode()
+	assert.False(t, Fits(UCS2, raw, 0))
+	parts = Split(UCS2, raw, UDHConcat8)
+	assert.Equal(t, 132, len(parts[0]))
+	assert.Equal(t, 14, len(parts[1]))
+	assert.Equal(t, 3, len(Split(UCS2, pdutext.UCS2(strings.Repeat("好", 135)).Encode(), UDHConcat16)))
+
+	raw = pdutext.Latin1(strings.Repeat("é", 141)).Encode()
+	parts = Split(Latin1, raw, UDHConcat16)
+	assert.Equal(t, 133, len(parts[0]))
+	assert.Equal(t, 8, len(parts[1]))
+}
+
+func TestToGSM7(t *testing.T) {
+	assert.Equal(t, "a?b€", ToGSM7("a`b€"))
+	assert.Equal(t, "a?b", ToLatin1("a好b"))
+}
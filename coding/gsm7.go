@@ -0,0 +1,96 @@
+package coding
+
+// escape switches to the extension table for the next septet.
+const escape = 0x1B
+
+// basicChars is the GSM 03.38 default alphabet by septet, 0x1B is the
+// escape to the extension table.
+const basicChars = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞ\x1bÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+	"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+
+// extensionChars is the GSM 03.38 extension table, each character is
+// sent as escape and its septet.
+var extensionChars = map[byte]rune{
+	0x0A: '\f', 0x14: '^', 0x28: '{', 0x29: '}', 0x2F: '\\',
+	0x3C: '[', 0x3D: '~', 0x3E: ']', 0x40: '|', 0x65: '€',
+}
+
+// gsm7Table maps characters to septets, extension characters to the
+// septet following the escape.
+type gsm7Table struct {
+	basic     map[rune]byte
+	extension map[rune]byte
+}
+
+var defaultTable = newGSM7Table(basicChars, extensionChars)
+
+func newGSM7Table(basic string, extension map[byte]rune) *gsm7Table {
+	t := &gsm7Table{basic: map[rune]byte{}, extension: map[rune]byte{}}
+	i := 0
+	for _, r := range basic {
+		if i != escape {
+			t.basic[r] = byte(i)
+		}
+		i++
+	}
+	for b, r := range extension {
+		// a character twice in the table is sent with its lowest septet
+		if prev, ok := t.extension[r]; !ok || b < prev {
+			t.extension[r] = b
+		}
+	}
+	return t
+}
+
+// septets returns the septets r takes, 0 if the table lacks it.
+func (t *gsm7Table) septets(r rune) int {
+	if _, ok := t.basic[r]; ok {
+		return 1
+	}
+	if _, ok := t.extension[r]; ok {
+		return 2
+	}
+	return 0
+}
+
+// IsGSM7 reports whether every character of s is in the default alphabet
+// or its extension table.
+func IsGSM7(s string) bool {
+	for _, r := range s {
+		if defaultTable.septets(r) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// GSM7Septets returns the septets s takes in the default alphabet, the
+// extension characters count twice. Characters outside of it are counted
+// as the '?' they are replaced with.
+func GSM7Septets(s string) int {
+	n := 0
+	for _, r := range s {
+		if c := defaultTable.septets(r); c > 0 {
+			n += c
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// ToGSM7 replaces the characters of s outside of the default alphabet and
+// its extension table with '?', so the GSM7 encoder takes every one.
+func ToGSM7(s string) string {
+	if IsGSM7(s) {
+		return s
+	}
+	out := make([]rune, 0, len(s))
+	for _, r := range s {
+		if defaultTable.septets(r) == 0 {
+			r = '?'
+		}
+		out = append(out, r)
+	}
+	return string(out)
+}
@@ -0,0 +1,250 @@
+package coding
+
+import (
+	"strings"
+
+	"github.com/skill215/go-smpp/smpp/pdu/pdutext"
+)
+
+// information elements of the user data header selecting a national
+// language table by 3GPP TS 23.038 section 6.2.1.2
+const (
+	IESingleShift  = 0x24
+	IELockingShift = 0x25
+)
+
+// Language is a national language of 3GPP TS 23.038 with its locking
+// shift table replacing the default alphabet and its single shift table
+// replacing the extension table, either may be missing.
+type Language struct {
+	ID      byte
+	Name    string
+	locking *gsm7Table
+	single  *gsm7Table
+}
+
+// Languages are the national languages the generator can pick from, the
+// other Indic tables of the specification are not included.
+var Languages = []*Language{
+	{ID: 1, Name: "turkish", locking: newGSM7Table(turkishLocking, nil), single: newGSM7Table("", turkishSingle)},
+	{ID: 2, Name: "spanish", single: newGSM7Table("", spanishSingle)},
+	{ID: 3, Name: "portuguese", locking: newGSM7Table(portugueseLocking, nil), single: newGSM7Table("", portugueseSingle)},
+	{ID: 6, Name: "hindi", locking: newGSM7Table(hindiLocking, nil), single: newGSM7Table("", hindiSingle)},
+}
+
+// LanguageByName returns the national language named s.
+func LanguageByName(s string) *Language {
+	for _, l := range Languages {
+		if strings.EqualFold(l.Name, s) {
+			return l
+		}
+	}
+	return nil
+}
+
+// the national language tables of 3GPP TS 23.038 annex A, by septet
+
+const turkishLocking = "@£$¥€éùıòÇ\nĞğ\rÅå" +
+	"Δ_ΦΓΛΩΠΨΣΘΞ\x1bŞşßÉ" +
+	" !\"#¤%&'()*+,-./" +
+	"0123456789:;<=>?" +
+	"İABCDEFGHIJKLMNO" +
+	"PQRSTUVWXYZÄÖÑÜ§" +
+	"çabcdefghijklmno" +
+	"pqrstuvwxyzäöñüà"
+
+const portugueseLocking = "@£$¥êéúíóç\nÔô\rÁá" +
+	"Δ_ªÇÀ∞^\\€Ó|\x1bÂâÊÉ" +
+	" !\"#º%&'()*+,-./" +
+	"0123456789:;<=>?" +
+	"ÍABCDEFGHIJKLMNO" +
+	"PQRSTUVWXYZÃÕÚÜ§" +
+	"~abcdefghijklmno" +
+	"pqrstuvwxyzãõ`üà"
+
+const hindiLocking = "ँंःअआइईउऊऋ\nऌऍ\rऎए" +
+	"ऐऑऒओऔकखगघङच\x1bछजझञ" +
+	" !टठडढणत)(थद,ध.न" +
+	"0123456789:;ऩपफ?" +
+	"बभमयरऱलळऴवशषसह़ऽ" +
+	"ािीुूृॄॅॆेैॉॊोौ्" +
+	"ॐabcdefghijklmno" +
+	"pqrstuvwxyzॲॻॼॾॿ"
+
+var turkishSingle = map[byte]rune{
+	0x0A: '\f', 0x14: '^', 0x28: '{', 0x29: '}', 0x2F: '\\', 0x3C: '[', 0x3D: '~',
+	0x3E: ']', 0x40: '|', 0x47: 'Ğ', 0x49: 'İ', 0x53: 'Ş', 0x63: 'ç', 0x65: '€',
+	0x67: 'ğ', 0x69: 'ı', 0x73: 'ş',
+}
+
+var spanishSingle = map[byte]rune{
+	0x09: 'ç', 0x0A: '\f', 0x14: '^', 0x28: '{', 0x29: '}', 0x2F: '\\', 0x3C: '[',
+	0x3D: '~', 0x3E: ']', 0x40: '|', 0x41: 'Á', 0x49: 'Í', 0x4F: 'Ó', 0x55: 'Ú',
+	0x61: 'á', 0x65: '€', 0x69: 'í', 0x6F: 'ó', 0x75: 'ú',
+}
+
+var portugueseSingle = map[byte]rune{
+	0x05: 'ê', 0x09: 'ç', 0x0A: '\f', 0x0B: 'Ô', 0x0C: 'ô', 0x0E: 'Á', 0x0F: 'á',
+	0x12: 'Φ', 0x13: 'Γ', 0x14: '^', 0x15: 'Ω', 0x16: 'Π', 0x17: 'Ψ', 0x18: 'Σ',
+	0x19: 'Θ', 0x1F: 'Ê', 0x28: '{', 0x29: '}', 0x2F: '\\', 0x3C: '[', 0x3D: '~',
+	0x3E: ']', 0x40: '|', 0x41: 'À', 0x49: 'Í', 0x4F: 'Ó', 0x55: 'Ú', 0x5B: 'Ã',
+	0x5C: 'Õ', 0x61: 'Â', 0x65: '€', 0x69: 'í', 0x6F: 'ó', 0x75: 'ú', 0x7B: 'ã',
+	0x7C: 'õ', 0x7F: 'â',
+}
+
+var hindiSingle = map[byte]rune{
+	0x00: '@', 0x01: '£', 0x02: '$', 0x03: '¥', 0x04: '¿', 0x05: '"', 0x06: '¤',
+	0x07: '%', 0x08: '&', 0x09: '\'', 0x0A: '\f', 0x0B: '*', 0x0C: '+', 0x0E: '-',
+	0x0F: '/', 0x10: '<', 0x11: '=', 0x12: '>', 0x13: '¡', 0x14: '^', 0x15: '¡',
+	0x16: '_', 0x17: '#', 0x18: '*', 0x19: '।', 0x1A: '॥', 0x1C: '०', 0x1D: '१',
+	0x1E: '२', 0x1F: '३', 0x20: '४', 0x21: '५', 0x22: '६', 0x23: '७', 0x24: '८',
+	0x25: '९', 0x26: '॑', 0x27: '॒', 0x28: '{', 0x29: '}', 0x2A: '॓', 0x2B: '॔',
+	0x2C: 'क़', 0x2D: 'ख़', 0x2E: 'ग़', 0x2F: '\\', 0x30: 'ज़', 0x31: 'ड़', 0x32: 'ढ़',
+	0x33: 'फ़', 0x34: 'य़', 0x35: 'ॠ', 0x36: 'ॡ', 0x37: 'ॢ', 0x38: 'ॣ', 0x39: '॰',
+	0x3A: 'ॱ', 0x3C: '[', 0x3D: '~', 0x3E: ']', 0x40: '|', 0x41: 'A', 0x42: 'B',
+	0x43: 'C', 0x44: 'D', 0x45: 'E', 0x46: 'F', 0x47: 'G', 0x48: 'H', 0x49: 'I',
+	0x4A: 'J', 0x4B: 'K', 0x4C: 'L', 0x4D: 'M', 0x4E: 'N', 0x4F: 'O', 0x50: 'P',
+	0x51: 'Q', 0x52: 'R', 0x53: 'S', 0x54: 'T', 0x55: 'U', 0x56: 'V', 0x57: 'W',
+	0x58: 'X', 0x59: 'Y', 0x5A: 'Z', 0x65: '€',
+}
+
+// NationalText is a GSM7 text using the locking shift table of one
+// national language and the single shift table of another, nil for the
+// default alphabet and extension table. Like pdutext.GSM7 it is encoded
+// a septet per octet, its user data header must carry IEs.
+type NationalText struct {
+	Text    string
+	Locking *Language
+	Single  *Language
+}
+
+func (t *NationalText) tables() (basic, extension *gsm7Table) {
+	basic, extension = defaultTable, defaultTable
+	if t.Locking != nil {
+		basic = t.Locking.locking
+	}
+	if t.Single != nil {
+		extension = t.Single.single
+	}
+	return basic, extension
+}
+
+// septets returns the septets r takes in the tables of t, 0 if they lack
+// it.
+func (t *NationalText) septets(r rune) int {
+	basic, extension := t.tables()
+	if _, ok := basic.basic[r]; ok {
+		return 1
+	}
+	if _, ok := extension.extension[r]; ok {
+		return 2
+	}
+	return 0
+}
+
+// Type implements pdutext.Codec.
+func (t *NationalText) Type() pdutext.DataCoding {
+	return GSM7
+}
+
+// Encode implements pdutext.Codec, characters the tables lack are sent as
+// '?'.
+func (t *NationalText) Encode() []byte {
+	basic, extension := t.tables()
+	out := make([]byte, 0, len(t.Text))
+	for _, r := range t.Text {
+		if b, ok := basic.basic[r]; ok {
+			out = append(out, b)
+		} else if b, ok := extension.extension[r]; ok {
+			out = append(out, escape, b)
+		} else {
+			out = append(out, basic.basic['?'])
+		}
+	}
+	return out
+}
+
+// Decode implements pdutext.Codec, it returns the text as UTF-8.
+func (t *NationalText) Decode() []byte {
+	return []byte(t.Text)
+}
+
+// IEs returns the information elements selecting the tables of t.
+func (t *NationalText) IEs() []byte {
+	var ies []byte
+	if t.Single != nil {
+		ies = append(ies, IESingleShift, 1, t.Single.ID)
+	}
+	if t.Locking != nil {
+		ies = append(ies, IELockingShift, 1, t.Locking.ID)
+	}
+	return ies
+}
+
+// Length returns the septets of the text.
+func (t *NationalText) Length() int {
+	n := 0
+	for _, r := range t.Text {
+		if c := t.septets(r); c > 0 {
+			n += c
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// UDHLen returns the octets of the user data header carrying the IEs.
+func (t *NationalText) UDHLen() int {
+	return 1 + len(t.IEs())
+}
+
+// Segments returns the number of parts of the text with the usual
+// concatenation header.
+func (t *NationalText) Segments() int {
+	raw := t.Encode()
+	if Fits(GSM7, raw, t.UDHLen()) {
+		return 1
+	}
+	return len(Split(GSM7, raw, t.UDHLen()+UDHConcat8-1))
+}
+
+// SelectNational returns the national text of s taking the fewest parts,
+// then septets, then header octets, among the tables of langs. It returns
+// nil if no combination of them takes every character of s.
+func SelectNational(s string, langs []*Language) *NationalText {
+	var best *NationalText
+	var bestSegments, bestSeptets int
+	try := func(t *NationalText) {
+		if t.Locking == nil && t.Single == nil {
+			return
+		}
+		for _, r := range s {
+			if t.septets(r) == 0 {
+				return
+			}
+		}
+		segments, septets := t.Segments(), t.Length()
+		if best == nil || segments < bestSegments ||
+			segments == bestSegments && (septets < bestSeptets ||
+				septets == bestSeptets && len(t.IEs()) < len(best.IEs())) {
+			best, bestSegments, bestSeptets = t, segments, septets
+		}
+	}
+	lockings := []*Language{nil}
+	singles := []*Language{nil}
+	for _, l := range langs {
+		if l.locking != nil {
+			lockings = append(lockings, l)
+		}
+		if l.single != nil {
+			singles = append(singles, l)
+		}
+	}
+	for _, locking := range lockings {
+		for _, single := range singles {
+			try(&NationalText{Text: s, Locking: locking, Single: single})
+		}
+	}
+	return best
+}
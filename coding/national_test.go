@@ -0,0 +1,60 @@
+package coding
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNationalTables(t *testing.T) {
+	for _, s := range []string{turkishLocking, portugueseLocking, hindiLocking} {
+		assert.Equal(t, 128, utf8.RuneCountInString(s))
+	}
+	assert.Equal(t, "turkish", LanguageByName("Turkish").Name)
+	assert.Nil(t, LanguageByName("klingon"))
+}
+
+func TestSelectNational(t *testing.T) {
+	turkish, spanish := LanguageByName("turkish"), LanguageByName("spanish")
+
+	// ş and ı are in the Turkish locking and single shift tables, ı is
+	// one septet with locking shift only
+	nt := SelectNational("Işık şimdi", Languages)
+	assert.Equal(t, turkish, nt.Locking)
+	assert.Nil(t, nt.Single)
+	assert.Equal(t, []byte{IELockingShift, 1, 1}, nt.IEs())
+	assert.Equal(t, 10, nt.Length())
+
+	// Spanish only has a single shift table
+	nt = SelectNational("canción", []*Language{spanish})
+	assert.Nil(t, nt.Locking)
+	assert.Equal(t, spanish, nt.Single)
+	assert.Equal(t, []byte{IESingleShift, 1, 2}, nt.IEs())
+	assert.Equal(t, []byte{'c', 'a', 'n', 'c', 'i', escape, 0x6F, 'n'}, nt.Encode())
+
+	// Hindi in the locking shift table, the danda in the single shift one
+	nt = SelectNational("नमस्ते।", Languages)
+	assert.Equal(t, "hindi", nt.Locking.Name)
+	assert.Equal(t, "hindi", nt.Single.Name)
+	assert.Equal(t, []byte{IESingleShift, 1, 6, IELockingShift, 1, 6}, nt.IEs())
+
+	// no table takes Chinese
+	assert.Nil(t, SelectNational("你好", Languages))
+	assert.Nil(t, SelectNational("Işık", []*Language{spanish}))
+}
+
+func TestNationalSegments(t *testing.T) {
+	// a UDH of 4 octets takes 5 of the 160 septets
+	nt := &NationalText{Text: strings.Repeat("ı", 155), Locking: LanguageByName("turkish")}
+	assert.Equal(t, 4, nt.UDHLen())
+	assert.Equal(t, 1, nt.Segments())
+	nt.Text += "ı"
+	assert.Equal(t, 2, nt.Segments())
+	// a UDH of 9 octets leaves 149 septets per part
+	nt.Text = strings.Repeat("ı", 298)
+	assert.Equal(t, 2, nt.Segments())
+	nt.Text += "ı"
+	assert.Equal(t, 3, nt.Segments())
+}
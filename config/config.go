@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/creasty/defaults"
 	yaml "gopkg.in/yaml.v3"
@@ -17,6 +18,51 @@ type AddrConfig struct {
 	GenerateType string `default:"sequence" yaml:"generate-type"`
 	Start        int    `default:"0" yaml:"start"`
 	Stop         int    `yaml:"stop"`
+	// csv generate-type: recipient list with a daddr column, and optional
+	// ton, npi, oaddr, content and variable columns
+	File string `yaml:"file,omitempty"`
+	// sequential or shuffle, a shuffled list is read into memory
+	Order string `default:"sequential" yaml:"order,omitempty"`
+	// start over at the end of the list instead of stopping
+	Loop bool `yaml:"loop,omitempty"`
+}
+
+// ProfilePhase is one phase of a traffic profile, rates are the total tps
+// of the connection group.
+type ProfilePhase struct {
+	// ramp, hold, step, sine or spike
+	Type     string        `yaml:"type"`
+	Duration time.Duration `yaml:"duration"`
+	// ramp and step go from From to To, step in Steps equal steps
+	From  int `yaml:"from,omitempty"`
+	To    int `yaml:"to,omitempty"`
+	Steps int `yaml:"steps,omitempty"`
+	// hold rate, sine mean and spike base rate
+	Tps int `yaml:"tps,omitempty"`
+	// sine swings Amplitude around Tps every Period
+	Amplitude int           `yaml:"amplitude,omitempty"`
+	Period    time.Duration `yaml:"period,omitempty"`
+	// spike sends Peak for SpikeLength at the start of the phase, and again
+	// every Period if set
+	Peak        int           `yaml:"peak,omitempty"`
+	SpikeLength time.Duration `yaml:"spike-length,omitempty"`
+}
+
+// TrafficProfile is a schedule of group rates that starts with the traffic.
+type TrafficProfile struct {
+	Phases []ProfilePhase `yaml:"phases,omitempty"`
+	// start again with the first phase after the last one
+	Repeat bool `yaml:"repeat,omitempty"`
+	// how often the rate is recomputed
+	Tick time.Duration `default:"1s" yaml:"tick"`
+}
+
+// MessageTemplate is a message content with placeholders, picked for a
+// message in proportion to its weight.
+type MessageTemplate struct {
+	Name    string `yaml:"name,omitempty"`
+	Weight  int    `default:"1" yaml:"weight"`
+	Content string `yaml:"content"`
 }
 
 type MessageConfig struct {
@@ -35,28 +81,183 @@ type MessageConfig struct {
 			Ton   uint16     `default:"1" yaml:"ton"`
 			Daddr AddrConfig `yaml:"daddr"`
 		} `yaml:"dst"`
-		RequireSR bool   `default:"false" yaml:"require-sr"`
-		Content   string `yaml:"content"`
+		RequireSR bool `default:"false" yaml:"require-sr"`
+		// how long to wait for the delivery receipt before counting it missing
+		ReceiptTimeout time.Duration `default:"5m" yaml:"receipt-timeout"`
+		// how long a receipt matching no submitted message waits for its
+		// submit_sm_resp before counting it orphan
+		OrphanTimeout time.Duration `default:"10s" yaml:"orphan-timeout"`
+		Content       string        `yaml:"content"`
+		// auto picks the cheapest of gsm7, latin1 and ucs2 for every
+		// message, or one of them or binary forced
+		DataCoding string `default:"auto" yaml:"data-coding"`
+		// national language shift tables of GSM7: auto uses any of them
+		// when the text would need ucs2 otherwise, a language is used
+		// whenever it takes the text instead of latin1 or ucs2, none
+		// keeps to the default alphabet
+		NationalLanguage string `default:"auto" yaml:"national-language"`
+		// how a text too long for one submit_sm is sent: udh8 or udh16
+		// concatenation headers, sar TLVs, or whole in message_payload
+		Concat string `default:"udh8" yaml:"concat"`
+		// weighted contents replacing content and content-mode when set
+		Templates []MessageTemplate `yaml:"templates,omitempty"`
+		// the other submit_sm fields, fixed or picked by weight
+		SubmitSM SubmitParams `yaml:"submit-sm,omitempty"`
+		// optional parameters attached to every submit_sm
+		TLVs []TLVConfig `yaml:"tlvs,omitempty"`
 	} `yaml:"send"`
+	TrafficProfile TrafficProfile `yaml:"traffic-profile"`
+}
+
+// BackoffConfig is the AIMD back-off of a bind: its rate is cut by
+// Decrease on a throttling response and grows back by Increase of the
+// target rate every Interval.
+type BackoffConfig struct {
+	Enable bool `default:"true" yaml:"enable"`
+	// share of the rate kept on a back-off
+	Decrease float64 `default:"0.5" yaml:"decrease"`
+	// share of the target rate added back every interval
+	Increase float64 `default:"0.05" yaml:"increase"`
+	// at most one back-off and one increase per interval
+	Interval time.Duration `default:"1s" yaml:"interval"`
+}
+
+// ReconnectConfig is how a connection binds again after a failed bind or
+// a lost session: the delay starts at InitialDelay and grows by
+// Multiplier with every failed bind in a row, up to MaxDelay.
+type ReconnectConfig struct {
+	InitialDelay time.Duration `default:"1s" yaml:"initial-delay"`
+	MaxDelay     time.Duration `default:"1m" yaml:"max-delay"`
+	Multiplier   float64       `default:"2" yaml:"multiplier"`
+	// share of the delay added or taken at random, so the connections of
+	// a group do not bind again in lockstep
+	Jitter float64 `default:"0.2" yaml:"jitter"`
+	// failed binds in a row before the connection gives up, 0 retries
+	// forever
+	MaxAttempts int `yaml:"max-attempts"`
+	// bind failure classes the connection gives up on at once: network,
+	// auth or rejected
+	Fatal []string `default:"[\"auth\"]" yaml:"fatal"`
+}
+
+// bind failure classes of ReconnectConfig.Fatal
+const (
+	// the connect or the bind exchange failed
+	BindFailureNetwork = "network"
+	// ESME_RINVPASWD or ESME_RINVSYSID
+	BindFailureAuth = "auth"
+	// any other error in the bind response, like ESME_RBINDFAIL
+	BindFailureRejected = "rejected"
+)
+
+// BindAccount is the system_id of a connection, with its own password or
+// the password of the server when empty.
+type BindAccount struct {
+	User     string `yaml:"user"`
+	Password string `yaml:"password,omitempty"`
+}
+
+// interfaceVersions are the interface_version of a bind by SMPP version.
+var interfaceVersions = map[string]uint8{"3.3": 0x33, "3.4": 0x34, "5.0": 0x50}
+
+// ParseInterfaceVersion returns the interface_version of an SMPP version.
+func ParseInterfaceVersion(s string) (uint8, error) {
+	v, ok := interfaceVersions[s]
+	if !ok {
+		return 0, fmt.Errorf("must be 3.3, 3.4 or 5.0, got %q", s)
+	}
+	return v, nil
 }
 
 type SmppConfig struct {
+	// optional name to address the group over the REST API
+	Name   string `yaml:"name,omitempty"`
 	Server struct {
 		Addr     string `default:"localhost" yaml:"addr"`
 		Port     uint16 `default:"5588" yaml:"port"`
 		User     string `yaml:"user"`
 		Password string `yaml:"password"`
+		// system_id and password by connection, taken in turn when there
+		// are fewer than conn-num, user and password when empty
+		Accounts []BindAccount `yaml:"accounts,omitempty"`
+		// the other bind fields: some servers route by system_type, a
+		// receiver gets the MOs and receipts of its address range
+		SystemType string `yaml:"system-type,omitempty"`
+		// 3.3, 3.4 or 5.0
+		InterfaceVersion string `default:"3.4" yaml:"interface-version"`
+		AddrTon          uint8  `yaml:"addr-ton,omitempty"`
+		AddrNpi          uint8  `yaml:"addr-npi,omitempty"`
+		AddressRange     string `yaml:"address-range,omitempty"`
+		// SMPP over TLS
+		TLS TLSConfig `yaml:"tls"`
 	} `yaml:"server"`
 	Client struct {
 		Type  string `default:"transmitter" yaml:"bind-type"`
 		Count uint16 `default:"10" yaml:"conn-num"`
+		// submit_sm a connection may send back to back after being idle,
+		// 1 spreads them evenly over the second
+		Burst int `default:"1" yaml:"burst"`
+		// submit_sm a connection may have outstanding without a response,
+		// 1 waits for every submit_sm_resp before the next submit_sm
+		Window int `default:"1" yaml:"window"`
+		// time to wait for a response before the request is given up
+		RespTimeout time.Duration `default:"5s" yaml:"resp-timeout"`
+		// reaction to ESME_RTHROTTLED and ESME_RMSGQFUL responses
+		Backoff BackoffConfig `yaml:"backoff"`
+		// binding again after a failed bind or a lost session
+		Reconnect ReconnectConfig `yaml:"reconnect"`
 	}
 	Message MessageConfig `yaml:"message"`
 }
 
+type SmscUser struct {
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+}
+
+type SmscErrorCode struct {
+	Status uint32 `yaml:"status"`
+	Weight int    `yaml:"weight"`
+}
+
+type SmscReceiptState struct {
+	State  string `yaml:"state"`
+	Weight int    `yaml:"weight"`
+}
+
+// SmscConfig configures the built-in mock SMSC.
+type SmscConfig struct {
+	Addr string `default:"0.0.0.0" yaml:"addr"`
+	Port uint16 `default:"2775" yaml:"port"`
+	// accepted system_id/password pairs, empty accepts every bind
+	Users  []SmscUser `yaml:"users,omitempty"`
+	Submit struct {
+		Latency       time.Duration `default:"10ms" yaml:"latency"`
+		LatencyJitter time.Duration `yaml:"latency-jitter"`
+		// fraction of submit_sm answered with one of error-codes
+		ErrorRate  float64         `yaml:"error-rate"`
+		ErrorCodes []SmscErrorCode `yaml:"error-codes,omitempty"`
+		// submit_sm per second and bind above which ESME_RTHROTTLED is returned, 0 disables
+		ThrottleTps int `yaml:"throttle-tps"`
+	} `yaml:"submit"`
+	Receipt struct {
+		Enable bool               `default:"true" yaml:"enable"`
+		Delay  time.Duration      `default:"1s" yaml:"delay"`
+		States []SmscReceiptState `yaml:"states,omitempty"`
+	} `yaml:"receipt"`
+	Mo struct {
+		// deliver_sm per second pushed round-robin to the receiving binds, 0 disables
+		Tps  int    `yaml:"tps"`
+		Src  string `default:"123456" yaml:"src"`
+		Dst  string `default:"1234" yaml:"dst"`
+		Text string `default:"mock MO message" yaml:"text"`
+	} `yaml:"mo"`
+}
+
 type AppConfig struct {
 	App struct {
 		SmppConn []SmppConfig `yaml:"smpp"`
+		Smsc     SmscConfig   `yaml:"smsc"`
 		Rest     struct {
 			Addr string `default:"0.0.0.0" yaml:"addr"`
 			Port uint16 `default:"8080" yaml:"port"`
@@ -78,6 +279,41 @@ func (c *AppConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	return nil
 }
 
+func (s *SmppConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	defaults.Set(s)
+
+	type plain SmppConfig
+	if err := unmarshal((*plain)(s)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *TrafficProfile) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	defaults.Set(p)
+
+	type plain TrafficProfile
+	if err := unmarshal((*plain)(p)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (t *MessageTemplate) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	defaults.Set(t)
+
+	type plain MessageTemplate
+	if err := unmarshal((*plain)(t)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetSmppConf reads the config file at path, an invalid config returns a
+// *ValidationError like a config posted to the REST API.
 func GetSmppConf(path string) (*AppConfig, error) {
 	c := &AppConfig{}
 	yamlFile, err := os.ReadFile(path)
@@ -89,6 +325,9 @@ func GetSmppConf(path string) (*AppConfig, error) {
 		fmt.Printf("parse conf err %v\n", err)
 		return nil, err
 	}
+	if err = c.Validate(); err != nil {
+		return nil, err
+	}
 	log.Printf("%+v", c)
 	return c, nil
 }
@@ -97,6 +336,24 @@ func (ac *AppConfig) GetRestAddr() string {
 	return fmt.Sprintf("%s:%d", ac.App.Rest.Addr, ac.App.Rest.Port)
 }
 
+func (ac *AppConfig) GetSmscAddr() string {
+	return fmt.Sprintf("%s:%d", ac.App.Smsc.Addr, ac.App.Smsc.Port)
+}
+
 func (s *SmppConfig) IsTransmitter() bool {
 	return !strings.EqualFold("receiver", s.Client.Type)
 }
+
+// Account returns the system_id and password connection i of the group
+// binds with.
+func (s *SmppConfig) Account(i int) (user, password string) {
+	n := len(s.Server.Accounts)
+	if n == 0 {
+		return s.Server.User, s.Server.Password
+	}
+	a := s.Server.Accounts[i%n]
+	if a.Password == "" {
+		return a.User, s.Server.Password
+	}
+	return a.User, a.Password
+}
@@ -1,14 +1,360 @@
 package config_test
 
 import (
+	"crypto/tls"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/skill215/smpp-app/config"
 	"github.com/stretchr/testify/assert"
+	yaml "gopkg.in/yaml.v3"
 )
 
 func TestReadConfig(t *testing.T) {
 	conf, err := config.GetSmppConf("smpp-app.yaml")
 	assert.Nil(t, err)
 	assert.True(t, len(conf.App.SmppConn) > 0)
+	assert.Equal(t, 10*time.Second, conf.App.SmppConn[0].Message.Send.OrphanTimeout)
+}
+
+func TestReadInvalidConfig(t *testing.T) {
+	data, err := os.ReadFile("smpp-app.yaml")
+	assert.Nil(t, err)
+	path := filepath.Join(t.TempDir(), "smpp-app.yaml")
+	data = []byte(strings.Replace(string(data), "receipt-timeout: 5m", "receipt-timeout: 0s", 1))
+	assert.Nil(t, os.WriteFile(path, data, 0o600))
+
+	_, err = config.GetSmppConf(path)
+	verr, ok := err.(*config.ValidationError)
+	assert.True(t, ok, "got %v", err)
+	assert.Equal(t, "service.smpp[0].message.send.receipt-timeout", verr.Fields[0].Field)
+}
+
+func TestValidateListsFields(t *testing.T) {
+	conf, err := config.GetSmppConf("smpp-app.yaml")
+	assert.Nil(t, err)
+	conf.App.SmppConn[0].Client.Type = "bogus"
+	conf.App.SmppConn[0].Client.Count = 0
+	conf.App.Log.Level = "loud"
+
+	err = conf.Validate()
+	verr, ok := err.(*config.ValidationError)
+	assert.True(t, ok)
+	fields := []string{}
+	for _, f := range verr.Fields {
+		fields = append(fields, f.Field)
+	}
+	assert.Equal(t, []string{
+		"service.smpp[0].client.bind-type",
+		"service.smpp[0].client.conn-num",
+		"service.log.level",
+	}, fields)
+}
+
+func TestRedactRoundTrip(t *testing.T) {
+	conf, err := config.GetSmppConf("smpp-app.yaml")
+	assert.Nil(t, err)
+	assert.Nil(t, conf.Validate())
+
+	out, err := yaml.Marshal(conf.Redact())
+	assert.Nil(t, err)
+	assert.NotContains(t, string(out), "password: smpp\n")
+	assert.Equal(t, "smpp", conf.App.SmppConn[0].Server.Password)
+
+	posted, err := config.ParseSmppConf(out)
+	assert.Nil(t, err)
+	assert.Equal(t, config.Redacted, posted.App.SmppConn[0].Server.Password)
+	assert.Nil(t, posted.KeepPasswords(conf))
+	assert.Equal(t, conf, posted)
+}
+
+func TestKeepPasswordsByGroup(t *testing.T) {
+	prev := &config.AppConfig{}
+	assert.Nil(t, yaml.Unmarshal([]byte(`
+service:
+  smpp:
+  - name: a
+    server: {addr: smsc1, user: one, password: pa}
+  - server: {addr: smsc2, user: two, password: pb, accounts: [{user: x, password: px}]}
+  smsc:
+    users: [{user: u, password: pu}, {user: v, password: pv}]
+`), prev))
+
+	// a group inserted in front and the others reordered
+	posted, err := config.ParseSmppConf([]byte(`
+service:
+  smpp:
+  - server: {addr: smsc3, user: three, password: pc}
+  - server: {addr: smsc2, user: two, password: "******", accounts: [{user: x, password: "******"}]}
+  - name: a
+    server: {addr: smsc9, user: one, password: "******"}
+  smsc:
+    users: [{user: v, password: "******"}]
+`))
+	assert.Nil(t, err)
+	assert.Nil(t, posted.KeepPasswords(prev))
+	assert.Equal(t, "pc", posted.App.SmppConn[0].Server.Password)
+	assert.Equal(t, "pb", posted.App.SmppConn[1].Server.Password)
+	assert.Equal(t, "px", posted.App.SmppConn[1].Server.Accounts[0].Password)
+	assert.Equal(t, "pa", posted.App.SmppConn[2].Server.Password)
+	assert.Equal(t, "pv", posted.App.Smsc.Users[0].Password)
+
+	// a redacted password of a new group or account is not guessed
+	posted, err = config.ParseSmppConf([]byte(`
+service:
+  smpp:
+  - server: {addr: smsc3, user: one, password: "******"}
+  - server: {addr: smsc2, user: two, password: "******", accounts: [{user: y, password: "******"}]}
+  smsc:
+    users: [{user: w, password: "******"}]
+`))
+	assert.Nil(t, err)
+	verr, ok := posted.KeepPasswords(prev).(*config.ValidationError)
+	assert.True(t, ok)
+	fields := []string{}
+	for _, f := range verr.Fields {
+		fields = append(fields, f.Field)
+	}
+	assert.Equal(t, []string{
+		"service.smpp[0].server.password",
+		"service.smpp[1].server.accounts[0].password",
+		"service.smsc.users[0].password",
+	}, fields)
+}
+
+func TestTemplateWeightDefault(t *testing.T) {
+	m := config.MessageConfig{}
+	assert.Nil(t, yaml.Unmarshal([]byte(`
+send:
+  templates:
+  - content: "a {otp}"
+  - content: "b"
+    weight: 0
+`), &m))
+	assert.Equal(t, 1, m.Send.Templates[0].Weight)
+	assert.Equal(t, 0, m.Send.Templates[1].Weight)
+}
+
+func TestSubmitParams(t *testing.T) {
+	m := config.MessageConfig{}
+	assert.Nil(t, yaml.Unmarshal([]byte(`
+send:
+  submit-sm:
+    service-type: CMT
+    protocol-id:
+    - value: 0
+      weight: 9
+    - value: 0x40
+    validity-period: 48h
+`), &m))
+	p := m.Send.SubmitSM
+	assert.Equal(t, config.Choice{{Value: "CMT", Weight: 1}}, p.ServiceType)
+	assert.Equal(t, config.Choice{{Value: "0", Weight: 9}, {Value: "0x40", Weight: 1}}, p.ProtocolID)
+	assert.Nil(t, p.ESMClass)
+
+	conf, err := config.GetSmppConf("smpp-app.yaml")
+	assert.Nil(t, err)
+	conf.App.SmppConn[0].Message.Send.SubmitSM = p
+	assert.Nil(t, conf.Validate())
+	conf.App.SmppConn[0].Message.Send.SubmitSM.PriorityFlag = config.Choice{{Value: "4", Weight: 1}}
+	conf.App.SmppConn[0].Message.Send.SubmitSM.ValidityPeriod = config.Choice{{Value: "1h", Weight: 1}, {Value: "tomorrow", Weight: 1}}
+	verr, ok := conf.Validate().(*config.ValidationError)
+	assert.True(t, ok)
+	fields := []string{}
+	for _, f := range verr.Fields {
+		fields = append(fields, f.Field)
+	}
+	assert.Equal(t, []string{
+		"service.smpp[0].message.send.submit-sm.priority-flag",
+		"service.smpp[0].message.send.submit-sm.validity-period[1]",
+	}, fields)
+}
+
+func TestSMPPTime(t *testing.T) {
+	for in, want := range map[string]string{
+		"":                          "",
+		"10m":                       "000000001000000R",
+		"49h30m5s":                  "000002013005000R",
+		"2030-01-02T03:04:05Z":      "300102030405000+",
+		"2030-01-02T05:04:05+02:00": "300102030405000+",
+		"000001000000000R":          "000001000000000R",
+	} {
+		got, err := config.SMPPTime(in)
+		assert.Nil(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+	for _, in := range []string{"-5m", "100d", "2400h", "soon"} {
+		_, err := config.SMPPTime(in)
+		assert.NotNil(t, err, in)
+	}
+}
+
+func TestTLVs(t *testing.T) {
+	tag, err := config.ParseTag("user_message_reference")
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(0x0204), tag)
+	tag, err = config.ParseTag("0x1401")
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(0x1401), tag)
+	for _, s := range []string{"0x0999", "0x4000", "sar_msg_ref_num", "0x0424", "bogus"} {
+		_, err = config.ParseTag(s)
+		assert.NotNil(t, err, s)
+	}
+
+	for _, c := range []struct {
+		typ, value string
+		want       []byte
+	}{
+		{"int8", "7", []byte{7}},
+		{"int16", "0x1F90", []byte{0x1F, 0x90}},
+		{"int32", "1", []byte{0, 0, 0, 1}},
+		{"cstring", "5551234", []byte("5551234\x00")},
+		{"octets", "0x01 02:ff", []byte{1, 2, 0xFF}},
+	} {
+		got, err := config.EncodeTLV(c.typ, c.value)
+		assert.Nil(t, err)
+		assert.Equal(t, c.want, got)
+	}
+	_, err = config.EncodeTLV("int8", "256")
+	assert.NotNil(t, err)
+	_, err = config.EncodeTLV("octets", "xyz")
+	assert.NotNil(t, err)
+
+	conf, err := config.GetSmppConf("smpp-app.yaml")
+	assert.Nil(t, err)
+	conf.App.SmppConn[0].Message.Send.TLVs = []config.TLVConfig{
+		{Tag: "source_port", Type: "int16", Value: config.Choice{{Value: "8080", Weight: 1}}},
+		{Tag: "0x1400", Type: "cstring", Generator: "seq"},
+		{Tag: "0x020A", Type: "int16", Generator: "random"},
+		{Tag: "callback_num", Type: "octets", Generator: "seq"},
+		{Tag: "payload_type", Type: "int8"},
+	}
+	verr, ok := conf.Validate().(*config.ValidationError)
+	assert.True(t, ok)
+	fields := []string{}
+	for _, f := range verr.Fields {
+		fields = append(fields, f.Field)
+	}
+	assert.Equal(t, []string{
+		"service.smpp[0].message.send.tlvs[2].tag",
+		"service.smpp[0].message.send.tlvs[3].generator",
+		"service.smpp[0].message.send.tlvs[4]",
+	}, fields)
+}
+
+func TestReconnect(t *testing.T) {
+	s := config.SmppConfig{}
+	assert.Nil(t, yaml.Unmarshal([]byte(`
+client:
+  reconnect:
+    max-delay: 30s
+`), &s))
+	r := s.Client.Reconnect
+	assert.Equal(t, time.Second, r.InitialDelay)
+	assert.Equal(t, 30*time.Second, r.MaxDelay)
+	assert.Equal(t, 2.0, r.Multiplier)
+	assert.Equal(t, []string{"auth"}, r.Fatal)
+
+	conf, err := config.GetSmppConf("smpp-app.yaml")
+	assert.Nil(t, err)
+	conf.App.SmppConn[0].Client.Reconnect = config.ReconnectConfig{
+		InitialDelay: time.Minute,
+		MaxDelay:     time.Second,
+		Multiplier:   0.5,
+		Jitter:       2,
+		Fatal:        []string{"rejected", "timeout"},
+	}
+	verr, ok := conf.Validate().(*config.ValidationError)
+	assert.True(t, ok)
+	fields := []string{}
+	for _, f := range verr.Fields {
+		fields = append(fields, f.Field)
+	}
+	assert.Equal(t, []string{
+		"service.smpp[0].client.reconnect.max-delay",
+		"service.smpp[0].client.reconnect.multiplier",
+		"service.smpp[0].client.reconnect.jitter",
+		"service.smpp[0].client.reconnect.fatal[1]",
+	}, fields)
+}
+
+func TestTLS(t *testing.T) {
+	s := config.SmppConfig{}
+	assert.Nil(t, yaml.Unmarshal([]byte(`
+server:
+  tls:
+    enable: true
+`), &s))
+	assert.Equal(t, "1.2", s.Server.TLS.MinVersion)
+	c, err := s.Server.TLS.ClientConfig()
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS12), c.MinVersion)
+	assert.Equal(t, "TLS1.3", config.TLSVersionName(tls.VersionTLS13))
+
+	conf, err := config.GetSmppConf("smpp-app.yaml")
+	assert.Nil(t, err)
+	conf.App.SmppConn = append(conf.App.SmppConn, conf.App.SmppConn[0], conf.App.SmppConn[0])
+	conf.App.SmppConn[1].Name, conf.App.SmppConn[2].Name = "b", "c"
+	conf.App.SmppConn[0].Server.TLS = config.TLSConfig{Enable: true, MinVersion: "1.4"}
+	conf.App.SmppConn[1].Server.TLS = config.TLSConfig{Enable: true, MinVersion: "1.2", Cert: "client.pem"}
+	conf.App.SmppConn[2].Server.TLS = config.TLSConfig{Enable: true, MinVersion: "1.2", CA: "missing.pem"}
+	verr, ok := conf.Validate().(*config.ValidationError)
+	assert.True(t, ok)
+	fields := []string{}
+	for _, f := range verr.Fields {
+		fields = append(fields, f.Field)
+	}
+	assert.Equal(t, []string{
+		"service.smpp[0].server.tls",
+		"service.smpp[1].server.tls",
+		"service.smpp[2].server.tls",
+	}, fields)
+}
+
+func TestBindAccounts(t *testing.T) {
+	s := config.SmppConfig{}
+	assert.Nil(t, yaml.Unmarshal([]byte(`
+server:
+  user: smpp1
+  password: smpp
+  interface-version: 5.0
+  accounts:
+  - user: a
+  - user: b
+    password: other
+`), &s))
+	assert.Equal(t, "5.0", s.Server.InterfaceVersion)
+	for i, want := range [][2]string{{"a", "smpp"}, {"b", "other"}, {"a", "smpp"}} {
+		user, password := s.Account(i)
+		assert.Equal(t, want, [2]string{user, password})
+	}
+
+	conf, err := config.GetSmppConf("smpp-app.yaml")
+	assert.Nil(t, err)
+	assert.Equal(t, "3.4", conf.App.SmppConn[0].Server.InterfaceVersion)
+	conf.App.SmppConn[0].Server.Accounts = s.Server.Accounts
+	redacted := conf.Redact()
+	assert.Equal(t, config.Redacted, redacted.App.SmppConn[0].Server.Accounts[1].Password)
+	assert.Equal(t, "", redacted.App.SmppConn[0].Server.Accounts[0].Password)
+	assert.Equal(t, "other", conf.App.SmppConn[0].Server.Accounts[1].Password)
+	assert.Nil(t, redacted.KeepPasswords(conf))
+	assert.Equal(t, conf, redacted)
+
+	conf.App.SmppConn[0].Server.Accounts = []config.BindAccount{{User: ""}}
+	conf.App.SmppConn[0].Server.InterfaceVersion = "3.5"
+	conf.App.SmppConn[0].Server.SystemType = "thirteen char"
+	verr, ok := conf.Validate().(*config.ValidationError)
+	assert.True(t, ok)
+	fields := []string{}
+	for _, f := range verr.Fields {
+		fields = append(fields, f.Field)
+	}
+	assert.Equal(t, []string{
+		"service.smpp[0].server.accounts[0].user",
+		"service.smpp[0].server.system-type",
+		"service.smpp[0].server.interface-version",
+	}, fields)
 }
@@ -0,0 +1,209 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/creasty/defaults"
+)
+
+// Choice is a submit_sm parameter given as a single value, or as weighted
+// values one of which is picked for every message:
+//
+//	protocol-id: 0
+//	protocol-id:
+//	  - value: 0
+//	    weight: 9
+//	  - value: 0x40
+//	    weight: 1
+type Choice []WeightedValue
+
+// WeightedValue is a value of a Choice picked in proportion to its weight.
+type WeightedValue struct {
+	Value  string `yaml:"value"`
+	Weight int    `default:"1" yaml:"weight"`
+}
+
+func (c *Choice) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var v string
+	if err := unmarshal(&v); err == nil {
+		*c = Choice{{Value: v, Weight: 1}}
+		return nil
+	}
+	var values []WeightedValue
+	if err := unmarshal(&values); err != nil {
+		return err
+	}
+	*c = values
+	return nil
+}
+
+func (w *WeightedValue) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	defaults.Set(w)
+
+	type plain WeightedValue
+	if err := unmarshal((*plain)(w)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SubmitParams are the submit_sm fields of every message besides the
+// addresses and the text, unset ones are sent as 0 or empty.
+type SubmitParams struct {
+	ServiceType Choice `yaml:"service-type,omitempty"`
+	// the UDHI bit is added to it for a concatenated message
+	ESMClass     Choice `yaml:"esm-class,omitempty"`
+	ProtocolID   Choice `yaml:"protocol-id,omitempty"`
+	PriorityFlag Choice `yaml:"priority-flag,omitempty"`
+	// a duration like 10m for a relative time, a time in RFC 3339 for an
+	// absolute one, or a time in the SMPP format
+	ScheduleDeliveryTime Choice `yaml:"schedule-delivery-time,omitempty"`
+	ValidityPeriod       Choice `yaml:"validity-period,omitempty"`
+	ReplaceIfPresent     Choice `yaml:"replace-if-present,omitempty"`
+	SMDefaultMsgID       Choice `yaml:"sm-default-msg-id,omitempty"`
+	// registered_delivery bits besides the SMSC receipt of require-sr:
+	// none, delivery, user or both SME acknowledgements, and true or
+	// false for intermediate notifications
+	SMEAck                   Choice `yaml:"sme-ack,omitempty"`
+	IntermediateNotification Choice `yaml:"intermediate-notification,omitempty"`
+}
+
+// registered_delivery bits of SubmitParams by SMPP 3.4 section 5.2.17
+const (
+	SMEAckDelivery           = 0x04
+	SMEAckUser               = 0x08
+	IntermediateNotification = 0x10
+)
+
+// ParseSMEAck returns the registered_delivery bits of an sme-ack value.
+func ParseSMEAck(s string) (uint8, error) {
+	switch strings.ToLower(s) {
+	case "", "none":
+		return 0, nil
+	case "delivery":
+		return SMEAckDelivery, nil
+	case "user":
+		return SMEAckUser, nil
+	case "both":
+		return SMEAckDelivery | SMEAckUser, nil
+	}
+	return 0, fmt.Errorf("must be none, delivery, user or both, got %q", s)
+}
+
+// ParseUint8 parses a decimal or 0x prefixed hex octet, empty is 0.
+func ParseUint8(s string) (uint8, error) {
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(s, 0, 8)
+	if err != nil {
+		return 0, fmt.Errorf("must be a number between 0 and 255, got %q", s)
+	}
+	return uint8(n), nil
+}
+
+// maxRelative is the longest relative time SMPPTime takes, the days of
+// the SMPP relative format have two digits.
+const maxRelative = 99 * 24 * time.Hour
+
+// SMPPTime returns a schedule_delivery_time or validity_period value in
+// the SMPP time format, YYMMDDhhmmsstnnp. s is a duration for a
+// relative time, an RFC 3339 time for an absolute one or already in the
+// SMPP format, empty is no time.
+func SMPPTime(s string) (string, error) {
+	if s == "" {
+		return "", nil
+	}
+	if len(s) == 16 && strings.IndexAny(s[15:], "R+-") == 0 {
+		if _, err := strconv.ParseUint(s[:15], 10, 64); err == nil {
+			return s, nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		if d <= 0 || d > maxRelative {
+			return "", fmt.Errorf("relative time must be between 1s and %s, got %q", maxRelative, s)
+		}
+		d = d.Round(time.Second)
+		days := int(d / (24 * time.Hour))
+		d -= time.Duration(days) * 24 * time.Hour
+		return fmt.Sprintf("0000%02d%02d%02d%02d000R", days, int(d/time.Hour), int(d%time.Hour/time.Minute), int(d%time.Minute/time.Second)), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC().Format("060102150405") + "000+", nil
+	}
+	return "", fmt.Errorf("must be a duration, an RFC 3339 time or in the SMPP format, got %q", s)
+}
+
+func (p *SubmitParams) validate(verr *ValidationError, prefix string) {
+	octet := func(s string) error {
+		_, err := ParseUint8(s)
+		return err
+	}
+	upTo := func(max uint8) func(string) error {
+		return func(s string) error {
+			if v, err := ParseUint8(s); err != nil || v > max {
+				return fmt.Errorf("must be between 0 and %d, got %q", max, s)
+			}
+			return nil
+		}
+	}
+	smppTime := func(s string) error {
+		_, err := SMPPTime(s)
+		return err
+	}
+	for _, c := range []struct {
+		name  string
+		value Choice
+		check func(string) error
+	}{
+		{"service-type", p.ServiceType, func(s string) error {
+			if len(s) > 5 {
+				return fmt.Errorf("must be at most 5 characters, got %q", s)
+			}
+			return nil
+		}},
+		{"esm-class", p.ESMClass, octet},
+		{"protocol-id", p.ProtocolID, octet},
+		{"priority-flag", p.PriorityFlag, upTo(3)},
+		{"schedule-delivery-time", p.ScheduleDeliveryTime, smppTime},
+		{"validity-period", p.ValidityPeriod, smppTime},
+		{"replace-if-present", p.ReplaceIfPresent, upTo(1)},
+		{"sm-default-msg-id", p.SMDefaultMsgID, octet},
+		{"sme-ack", p.SMEAck, func(s string) error {
+			_, err := ParseSMEAck(s)
+			return err
+		}},
+		{"intermediate-notification", p.IntermediateNotification, func(s string) error {
+			if _, err := strconv.ParseBool(s); err != nil {
+				return fmt.Errorf("must be true or false, got %q", s)
+			}
+			return nil
+		}},
+	} {
+		c.value.validate(verr, prefix+"."+c.name, c.check)
+	}
+}
+
+func (c Choice) validate(verr *ValidationError, field string, check func(string) error) {
+	weights := 0
+	for i, v := range c {
+		name := field
+		if len(c) > 1 {
+			name = fmt.Sprintf("%s[%d]", field, i)
+		}
+		if err := check(v.Value); err != nil {
+			verr.add(name, "%v", err)
+		}
+		if v.Weight < 0 {
+			verr.add(name+".weight", "must not be negative")
+		}
+		weights += v.Weight
+	}
+	if len(c) > 0 && weights == 0 {
+		verr.add(field, "at least one weight must be positive")
+	}
+}
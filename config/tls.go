@@ -0,0 +1,88 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// TLSConfig is SMPP over TLS to a server, files are in PEM.
+type TLSConfig struct {
+	Enable bool `yaml:"enable"`
+	// CA bundle the server certificate is checked against, the system
+	// roots when empty
+	CA string `yaml:"ca,omitempty"`
+	// client certificate and key for mutual TLS
+	Cert string `yaml:"cert,omitempty"`
+	Key  string `yaml:"key,omitempty"`
+	// name checked against the server certificate, the server addr when
+	// empty
+	ServerName string `yaml:"server-name,omitempty"`
+	// accept any server certificate, for a lab only
+	InsecureSkipVerify bool `yaml:"insecure-skip-verify,omitempty"`
+	// lowest version accepted: 1.0, 1.1, 1.2 or 1.3
+	MinVersion string `default:"1.2" yaml:"min-version"`
+}
+
+// tlsVersions are the TLS versions by their number.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// TLSVersionName returns the name of a negotiated TLS version, like
+// TLS1.3.
+func TLSVersionName(v uint16) string {
+	for name, version := range tlsVersions {
+		if version == v {
+			return "TLS" + name
+		}
+	}
+	return fmt.Sprintf("0x%04X", v)
+}
+
+// ClientConfig returns the TLS config of a bind, reading the files again
+// so a renewed certificate is used from the next bind on.
+func (t *TLSConfig) ClientConfig() (*tls.Config, error) {
+	c := &tls.Config{
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+	var ok bool
+	if c.MinVersion, ok = tlsVersions[t.MinVersion]; !ok {
+		return nil, fmt.Errorf("min-version must be 1.0, 1.1, 1.2 or 1.3, got %q", t.MinVersion)
+	}
+	if t.CA != "" {
+		pem, err := os.ReadFile(t.CA)
+		if err != nil {
+			return nil, fmt.Errorf("ca: %w", err)
+		}
+		c.RootCAs = x509.NewCertPool()
+		if !c.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ca: no certificate in %s", t.CA)
+		}
+	}
+	if (t.Cert == "") != (t.Key == "") {
+		return nil, fmt.Errorf("cert and key must be set together")
+	}
+	if t.Cert != "" {
+		cert, err := tls.LoadX509KeyPair(t.Cert, t.Key)
+		if err != nil {
+			return nil, fmt.Errorf("cert: %w", err)
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+	return c, nil
+}
+
+func (t *TLSConfig) validate(verr *ValidationError, field string) {
+	if !t.Enable {
+		return
+	}
+	if _, err := t.ClientConfig(); err != nil {
+		verr.add(field, "%v", err)
+	}
+}
@@ -0,0 +1,203 @@
+package config
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/creasty/defaults"
+)
+
+// TLVConfig is an optional parameter attached to every submit_sm, with a
+// value or weighted values, or generated for every message.
+type TLVConfig struct {
+	// a number or the name of an SMPP 3.4 optional parameter
+	Tag string `yaml:"tag"`
+	// int8, int16, int32, cstring, or octets given in hex
+	Type string `yaml:"type"`
+	// cstring values may hold the placeholders of the templates
+	Value Choice `yaml:"value,omitempty"`
+	// seq or random instead of a value
+	Generator string `yaml:"generator,omitempty"`
+	// length of a random cstring or octets value
+	Length int `default:"8" yaml:"length,omitempty"`
+}
+
+func (t *TLVConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	defaults.Set(t)
+
+	type plain TLVConfig
+	if err := unmarshal((*plain)(t)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// vendor specific optional parameters by SMPP 3.4 section 5.3.2
+const (
+	vendorTagFirst = 0x1400
+	vendorTagLast  = 0x3FFF
+)
+
+// tlvTags are the optional parameters of SMPP 3.4 by name.
+var tlvTags = map[string]uint16{
+	"dest_addr_subunit":           0x0005,
+	"dest_network_type":           0x0006,
+	"dest_bearer_type":            0x0007,
+	"dest_telematics_id":          0x0008,
+	"source_addr_subunit":         0x000D,
+	"source_network_type":         0x000E,
+	"source_bearer_type":          0x000F,
+	"source_telematics_id":        0x0010,
+	"qos_time_to_live":            0x0017,
+	"payload_type":                0x0019,
+	"additional_status_info_text": 0x001D,
+	"receipted_message_id":        0x001E,
+	"ms_msg_wait_facilities":      0x0030,
+	"privacy_indicator":           0x0201,
+	"source_subaddress":           0x0202,
+	"dest_subaddress":             0x0203,
+	"user_message_reference":      0x0204,
+	"user_response_code":          0x0205,
+	"source_port":                 0x020A,
+	"destination_port":            0x020B,
+	"sar_msg_ref_num":             0x020C,
+	"language_indicator":          0x020D,
+	"sar_total_segments":          0x020E,
+	"sar_segment_seqnum":          0x020F,
+	"sc_interface_version":        0x0210,
+	"callback_num_pres_ind":       0x0302,
+	"callback_num_atag":           0x0303,
+	"number_of_messages":          0x0304,
+	"callback_num":                0x0381,
+	"dpf_result":                  0x0420,
+	"set_dpf":                     0x0421,
+	"ms_availability_status":      0x0422,
+	"network_error_code":          0x0423,
+	"message_payload":             0x0424,
+	"delivery_failure_reason":     0x0425,
+	"more_messages_to_send":       0x0426,
+	"message_state":               0x0427,
+	"ussd_service_op":             0x0501,
+	"display_time":                0x1201,
+	"sms_signal":                  0x1203,
+	"ms_validity":                 0x1204,
+	"alert_on_message_delivery":   0x130C,
+	"its_reply_type":              0x1380,
+	"its_session_info":            0x1383,
+}
+
+// concatTags are set by the concat method, not by tlvs.
+var concatTags = map[uint16]bool{0x020C: true, 0x020E: true, 0x020F: true, 0x0424: true}
+
+// ParseTag returns the tag of an optional parameter given by name or
+// number, a number must be an SMPP 3.4 tag or in the vendor range.
+func ParseTag(s string) (uint16, error) {
+	tag, ok := tlvTags[strings.ToLower(s)]
+	if !ok {
+		n, err := strconv.ParseUint(s, 0, 16)
+		if err != nil {
+			return 0, fmt.Errorf("must be a number or the name of an optional parameter, got %q", s)
+		}
+		tag = uint16(n)
+		known := false
+		for _, t := range tlvTags {
+			known = known || t == tag
+		}
+		if !known && (tag < vendorTagFirst || tag > vendorTagLast) {
+			return 0, fmt.Errorf("must be an SMPP 3.4 optional parameter or a vendor tag between 0x%04X and 0x%04X, got %q", vendorTagFirst, vendorTagLast, s)
+		}
+	}
+	if concatTags[tag] {
+		return 0, fmt.Errorf("0x%04X is set by concat", tag)
+	}
+	return tag, nil
+}
+
+// TLVBits returns the width of an integer TLV type, 0 for the others and
+// -1 for an unknown one.
+func TLVBits(typ string) int {
+	switch strings.ToLower(typ) {
+	case "int8":
+		return 8
+	case "int16":
+		return 16
+	case "int32":
+		return 32
+	case "cstring", "octets":
+		return 0
+	}
+	return -1
+}
+
+// EncodeTLV returns the value of an optional parameter of a type: an
+// unsigned integer in network byte order, a NULL terminated string or
+// octets given in hex.
+func EncodeTLV(typ, value string) ([]byte, error) {
+	switch bits := TLVBits(typ); {
+	case bits > 0:
+		n, err := strconv.ParseUint(value, 0, bits)
+		if err != nil {
+			return nil, fmt.Errorf("must be a number that fits %s, got %q", typ, value)
+		}
+		return EncodeTLVInt(bits, n), nil
+	case bits < 0:
+		return nil, fmt.Errorf("type must be int8, int16, int32, cstring or octets, got %q", typ)
+	}
+	if strings.EqualFold(typ, "cstring") {
+		return append([]byte(value), 0), nil
+	}
+	s := strings.TrimPrefix(strings.TrimPrefix(value, "0x"), "0X")
+	s = strings.NewReplacer(" ", "", ":", "").Replace(s)
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("must be octets in hex, got %q", value)
+	}
+	return b, nil
+}
+
+// EncodeTLVInt returns n in bits/8 octets in network byte order.
+func EncodeTLVInt(bits int, n uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, n)
+	return b[8-bits/8:]
+}
+
+func (t *TLVConfig) validate(verr *ValidationError, field string) {
+	if _, err := ParseTag(t.Tag); err != nil {
+		verr.add(field+".tag", "%v", err)
+	}
+	bits := TLVBits(t.Type)
+	if bits < 0 {
+		verr.add(field+".type", "must be int8, int16, int32, cstring or octets, got %q", t.Type)
+		return
+	}
+	switch strings.ToLower(t.Generator) {
+	case "":
+		if len(t.Value) == 0 {
+			verr.add(field, "needs a value or a generator")
+		}
+		// any cstring passes, its placeholders are filled in per message
+		check := func(s string) error {
+			_, err := EncodeTLV(t.Type, s)
+			return err
+		}
+		t.Value.validate(verr, field+".value", check)
+	case "seq":
+		if strings.EqualFold(t.Type, "octets") {
+			verr.add(field+".generator", "seq needs an int or cstring type")
+		}
+	case "random":
+		if bits == 0 && (t.Length < 1 || t.Length > 255) {
+			verr.add(field+".length", "must be between 1 and 255")
+		}
+	default:
+		verr.add(field+".generator", "must be seq or random, got %q", t.Generator)
+	}
+	if t.Generator != "" && len(t.Value) > 0 {
+		verr.add(field, "takes a value or a generator, not both")
+	}
+}
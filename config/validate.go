@@ -0,0 +1,398 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// Redacted replaces passwords in the config returned by the REST API.
+const Redacted = "******"
+
+// FieldError is one invalid configuration field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every invalid field of a configuration.
+type ValidationError struct {
+	Fields []FieldError `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	msgs := []string{}
+	for _, f := range e.Fields {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", f.Field, f.Message))
+	}
+	return "invalid config: " + strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) add(field, format string, args ...interface{}) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// ParseSmppConf parses and validates a YAML configuration document.
+func ParseSmppConf(data []byte) (*AppConfig, error) {
+	c := &AppConfig{}
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return nil, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Validate checks the configuration and returns a *ValidationError listing
+// the invalid fields, or nil.
+func (ac *AppConfig) Validate() error {
+	verr := &ValidationError{}
+	if len(ac.App.SmppConn) == 0 {
+		verr.add("service.smpp", "at least one connection group is required")
+	}
+	names := map[string]bool{}
+	for i, s := range ac.App.SmppConn {
+		prefix := fmt.Sprintf("service.smpp[%d]", i)
+		if s.Name != "" {
+			if names[s.Name] {
+				verr.add(prefix+".name", "duplicate name %q", s.Name)
+			}
+			names[s.Name] = true
+		}
+		if s.Server.Addr == "" {
+			verr.add(prefix+".server.addr", "must not be empty")
+		}
+		if s.Server.Port == 0 {
+			verr.add(prefix+".server.port", "must not be 0")
+		}
+		for j, a := range s.Server.Accounts {
+			if a.User == "" || len(a.User) > 15 {
+				verr.add(fmt.Sprintf("%s.server.accounts[%d].user", prefix, j), "must be 1 to 15 characters")
+			}
+		}
+		if len(s.Server.SystemType) > 12 {
+			verr.add(prefix+".server.system-type", "must be at most 12 characters")
+		}
+		if _, err := ParseInterfaceVersion(s.Server.InterfaceVersion); err != nil {
+			verr.add(prefix+".server.interface-version", "%v", err)
+		}
+		if len(s.Server.AddressRange) > 40 {
+			verr.add(prefix+".server.address-range", "must be at most 40 characters")
+		}
+		s.Server.TLS.validate(verr, prefix+".server.tls")
+		switch strings.ToLower(s.Client.Type) {
+		case "transmitter", "receiver", "transceiver":
+		default:
+			verr.add(prefix+".client.bind-type", "must be transmitter, receiver or transceiver, got %q", s.Client.Type)
+		}
+		if s.Client.Count == 0 {
+			verr.add(prefix+".client.conn-num", "must be at least 1")
+		}
+		if s.Client.Window < 1 {
+			verr.add(prefix+".client.window", "must be at least 1")
+		}
+		if s.Client.RespTimeout <= 0 {
+			verr.add(prefix+".client.resp-timeout", "must be positive")
+		}
+		if b := s.Client.Backoff; b.Enable {
+			if b.Decrease <= 0 || b.Decrease >= 1 {
+				verr.add(prefix+".client.backoff.decrease", "must be between 0 and 1 exclusive")
+			}
+			if b.Increase <= 0 || b.Increase > 1 {
+				verr.add(prefix+".client.backoff.increase", "must be above 0 and at most 1")
+			}
+			if b.Interval <= 0 {
+				verr.add(prefix+".client.backoff.interval", "must be positive")
+			}
+		}
+		r := s.Client.Reconnect
+		if r.InitialDelay <= 0 {
+			verr.add(prefix+".client.reconnect.initial-delay", "must be positive")
+		}
+		if r.MaxDelay < r.InitialDelay {
+			verr.add(prefix+".client.reconnect.max-delay", "must be at least initial-delay")
+		}
+		if r.Multiplier < 1 {
+			verr.add(prefix+".client.reconnect.multiplier", "must be at least 1")
+		}
+		if r.Jitter < 0 || r.Jitter > 1 {
+			verr.add(prefix+".client.reconnect.jitter", "must be between 0 and 1")
+		}
+		if r.MaxAttempts < 0 {
+			verr.add(prefix+".client.reconnect.max-attempts", "must not be negative")
+		}
+		for j, class := range r.Fatal {
+			switch strings.ToLower(class) {
+			case BindFailureNetwork, BindFailureAuth, BindFailureRejected:
+			default:
+				verr.add(fmt.Sprintf("%s.client.reconnect.fatal[%d]", prefix, j), "must be network, auth or rejected, got %q", class)
+			}
+		}
+		send := s.Message.Send
+		switch send.ContentMode {
+		case "random", "pre-defined", "mixed":
+		default:
+			verr.add(prefix+".message.send.content-mode", "must be random, pre-defined or mixed, got %q", send.ContentMode)
+		}
+		if send.PreDefinedContentRatio < 0 || send.PreDefinedContentRatio > 1 {
+			verr.add(prefix+".message.send.pre-defined-content-ratio", "must be between 0 and 1")
+		}
+		switch strings.ToLower(send.Dst.Daddr.GenerateType) {
+		case "sequence", "random":
+		case "csv":
+			if send.Dst.Daddr.File == "" {
+				verr.add(prefix+".message.send.dst.daddr.file", "is required for generate-type csv")
+			}
+			switch strings.ToLower(send.Dst.Daddr.Order) {
+			case "sequential", "shuffle":
+			default:
+				verr.add(prefix+".message.send.dst.daddr.order", "must be sequential or shuffle, got %q", send.Dst.Daddr.Order)
+			}
+		default:
+			verr.add(prefix+".message.send.dst.daddr.generate-type", "must be sequence, random or csv, got %q", send.Dst.Daddr.GenerateType)
+		}
+		if send.Dst.Daddr.GenerateLen < 1 || send.Dst.Daddr.GenerateLen > 18 {
+			verr.add(prefix+".message.send.dst.daddr.generate-length", "must be between 1 and 18")
+		}
+		switch strings.ToLower(send.DataCoding) {
+		case "auto", "gsm7", "latin1", "ucs2", "binary":
+		default:
+			verr.add(prefix+".message.send.data-coding", "must be auto, gsm7, latin1, ucs2 or binary, got %q", send.DataCoding)
+		}
+		switch strings.ToLower(send.NationalLanguage) {
+		case "auto", "none", "turkish", "spanish", "portuguese", "hindi":
+		default:
+			verr.add(prefix+".message.send.national-language", "must be auto, none, turkish, spanish, portuguese or hindi, got %q", send.NationalLanguage)
+		}
+		switch strings.ToLower(send.Concat) {
+		case "udh8", "udh16", "sar", "payload":
+		default:
+			verr.add(prefix+".message.send.concat", "must be udh8, udh16, sar or payload, got %q", send.Concat)
+		}
+		weights := 0
+		for j, t := range send.Templates {
+			field := fmt.Sprintf("%s.message.send.templates[%d]", prefix, j)
+			if t.Content == "" {
+				verr.add(field+".content", "must not be empty")
+			}
+			if t.Weight < 0 {
+				verr.add(field+".weight", "must not be negative")
+			}
+			weights += t.Weight
+		}
+		if len(send.Templates) > 0 && weights == 0 {
+			verr.add(prefix+".message.send.templates", "at least one weight must be positive")
+		}
+		if send.ReceiptTimeout <= 0 {
+			verr.add(prefix+".message.send.receipt-timeout", "must be positive")
+		}
+		if send.OrphanTimeout <= 0 {
+			verr.add(prefix+".message.send.orphan-timeout", "must be positive")
+		}
+		send.SubmitSM.validate(verr, prefix+".message.send.submit-sm")
+		tags := map[uint16]bool{}
+		for j := range send.TLVs {
+			field := fmt.Sprintf("%s.message.send.tlvs[%d]", prefix, j)
+			send.TLVs[j].validate(verr, field)
+			if tag, err := ParseTag(send.TLVs[j].Tag); err == nil {
+				if tags[tag] {
+					verr.add(field+".tag", "0x%04X is set twice", tag)
+				}
+				tags[tag] = true
+			}
+		}
+		s.Message.TrafficProfile.validate(verr, prefix+".message.traffic-profile")
+	}
+	if ac.App.Rest.Port == 0 {
+		verr.add("service.rest.port", "must not be 0")
+	}
+	if ac.App.Smsc.Submit.ErrorRate < 0 || ac.App.Smsc.Submit.ErrorRate > 1 {
+		verr.add("service.smsc.submit.error-rate", "must be between 0 and 1")
+	}
+	switch strings.ToLower(ac.App.Log.Level) {
+	case "trace", "debug", "info", "warn", "warning", "error", "fatal", "panic":
+	default:
+		verr.add("service.log.level", "unknown level %q", ac.App.Log.Level)
+	}
+	if len(verr.Fields) > 0 {
+		return verr
+	}
+	return nil
+}
+
+// Validate checks a traffic profile posted on its own.
+func (p *TrafficProfile) Validate() error {
+	verr := &ValidationError{}
+	if len(p.Phases) == 0 {
+		verr.add("phases", "at least one phase is required")
+	}
+	p.validate(verr, "")
+	if len(verr.Fields) > 0 {
+		return verr
+	}
+	return nil
+}
+
+func (p *TrafficProfile) validate(verr *ValidationError, prefix string) {
+	if prefix != "" {
+		prefix += "."
+	}
+	if len(p.Phases) > 0 && p.Tick <= 0 {
+		verr.add(prefix+"tick", "must be positive")
+	}
+	for i, ph := range p.Phases {
+		field := fmt.Sprintf("%sphases[%d]", prefix, i)
+		if ph.Duration <= 0 {
+			verr.add(field+".duration", "must be positive")
+		}
+		if ph.From < 0 || ph.To < 0 || ph.Tps < 0 || ph.Peak < 0 {
+			verr.add(field, "rates must not be negative")
+		}
+		switch ph.Type {
+		case "ramp", "hold", "step":
+		case "sine":
+			if ph.Period <= 0 {
+				verr.add(field+".period", "must be positive for a sine phase")
+			}
+		case "spike":
+			if ph.SpikeLength <= 0 {
+				verr.add(field+".spike-length", "must be positive for a spike phase")
+			}
+		default:
+			verr.add(field+".type", "must be ramp, hold, step, sine or spike, got %q", ph.Type)
+		}
+	}
+}
+
+// Redact returns a copy of the config with every password replaced by
+// Redacted.
+func (ac *AppConfig) Redact() *AppConfig {
+	c := *ac
+	c.App.SmppConn = append([]SmppConfig(nil), ac.App.SmppConn...)
+	for i := range c.App.SmppConn {
+		server := &c.App.SmppConn[i].Server
+		if server.Password != "" {
+			server.Password = Redacted
+		}
+		server.Accounts = append([]BindAccount(nil), server.Accounts...)
+		for j := range server.Accounts {
+			if server.Accounts[j].Password != "" {
+				server.Accounts[j].Password = Redacted
+			}
+		}
+	}
+	c.App.Smsc.Users = append([]SmscUser(nil), ac.App.Smsc.Users...)
+	for i := range c.App.Smsc.Users {
+		if c.App.Smsc.Users[i].Password != "" {
+			c.App.Smsc.Users[i].Password = Redacted
+		}
+	}
+	return &c
+}
+
+// KeepPasswords restores the passwords that were posted back redacted from
+// prev, so a config fetched from the REST API can be edited and posted again.
+// A connection group is matched by name, or by server address, port and
+// system_id when no group of prev has its name, its accounts by system_id.
+// SMSC users are matched by user. A redacted password that matches nothing,
+// or matches passwords that differ, is returned as a *ValidationError.
+func (ac *AppConfig) KeepPasswords(prev *AppConfig) error {
+	verr := &ValidationError{}
+	for i := range ac.App.SmppConn {
+		prefix := fmt.Sprintf("service.smpp[%d].server", i)
+		server := &ac.App.SmppConn[i].Server
+		olds := prev.sameGroups(&ac.App.SmppConn[i])
+		if server.Password == Redacted {
+			passwords := []string{}
+			for _, old := range olds {
+				passwords = append(passwords, old.Server.Password)
+			}
+			if !keepPassword(&server.Password, passwords) {
+				verr.add(prefix+".password", "is redacted and matches no running connection group")
+			}
+		}
+		for j := range server.Accounts {
+			account := &server.Accounts[j]
+			if account.Password != Redacted {
+				continue
+			}
+			passwords := []string{}
+			for _, old := range olds {
+				for _, a := range old.Server.Accounts {
+					if a.User == account.User {
+						passwords = append(passwords, a.Password)
+					}
+				}
+			}
+			if !keepPassword(&account.Password, passwords) {
+				verr.add(fmt.Sprintf("%s.accounts[%d].password", prefix, j), "is redacted and matches no account of the running group")
+			}
+		}
+	}
+	for i := range ac.App.Smsc.Users {
+		user := &ac.App.Smsc.Users[i]
+		if user.Password != Redacted {
+			continue
+		}
+		passwords := []string{}
+		for _, old := range prev.App.Smsc.Users {
+			if old.User == user.User {
+				passwords = append(passwords, old.Password)
+			}
+		}
+		if !keepPassword(&user.Password, passwords) {
+			verr.add(fmt.Sprintf("service.smsc.users[%d].password", i), "is redacted and matches no running user")
+		}
+	}
+	if len(verr.Fields) > 0 {
+		return verr
+	}
+	return nil
+}
+
+// sameGroups returns the connection groups of ac that s was posted for:
+// the group of the same name, else those binding to the same server with
+// the same system_id.
+func (ac *AppConfig) sameGroups(s *SmppConfig) []*SmppConfig {
+	groups := []*SmppConfig{}
+	if s.Name != "" {
+		for i := range ac.App.SmppConn {
+			if ac.App.SmppConn[i].Name == s.Name {
+				return append(groups, &ac.App.SmppConn[i])
+			}
+		}
+	}
+	for i := range ac.App.SmppConn {
+		old := &ac.App.SmppConn[i]
+		if old.Server.Addr == s.Server.Addr && old.Server.Port == s.Server.Port && old.Server.User == s.Server.User {
+			groups = append(groups, old)
+		}
+	}
+	return groups
+}
+
+// keepPassword sets password to the one every match has, and reports false
+// when there is no match or the matches differ.
+func keepPassword(password *string, matches []string) bool {
+	if len(matches) == 0 {
+		return false
+	}
+	for _, m := range matches[1:] {
+		if m != matches[0] {
+			return false
+		}
+	}
+	*password = matches[0]
+	return true
+}
+
+// SameConnection reports whether two connection groups bind and pace the
+// same way, so a change between them only touches message settings.
+func (s *SmppConfig) SameConnection(o *SmppConfig) bool {
+	a, b := s.Client, o.Client
+	a.Type, b.Type = strings.ToLower(a.Type), strings.ToLower(b.Type)
+	return reflect.DeepEqual(s.Server, o.Server) && reflect.DeepEqual(a, b)
+}
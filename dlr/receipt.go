@@ -0,0 +1,196 @@
+package dlr
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skill215/go-smpp/smpp/pdu"
+	"github.com/skill215/go-smpp/smpp/pdu/pdufield"
+	"github.com/skill215/go-smpp/smpp/pdu/pdutlv"
+)
+
+// esm_class message type bits, SMPP 3.4 section 5.2.12
+const (
+	esmTypeMask         = 0x3c
+	esmTypeDeliveryAck  = 0x04
+	esmTypeIntermediate = 0x20
+)
+
+// TagMessageState is the message_state TLV carried by deliver_sm receipts,
+// pdutlv only knows the submit side tag message_state_option.
+const TagMessageState pdutlv.Tag = 0x0427
+
+var ErrNotReceipt = errors.New("pdu is not a delivery receipt")
+
+// final message states as reported in the stat: field of the receipt text
+var messageStates = map[uint8]string{
+	1: "ENROUTE",
+	2: "DELIVRD",
+	3: "EXPIRED",
+	4: "DELETED",
+	5: "UNDELIV",
+	6: "ACCEPTD",
+	7: "UNKNOWN",
+	8: "REJECTD",
+}
+
+var (
+	idRe         = regexp.MustCompile(`(?i)\bid:(\S+)`)
+	subRe        = regexp.MustCompile(`(?i)\bsub:(\d+)`)
+	dlvrdRe      = regexp.MustCompile(`(?i)\bdlvrd:(\d+)`)
+	submitDateRe = regexp.MustCompile(`(?i)\bsubmit date:(\d+)`)
+	doneDateRe   = regexp.MustCompile(`(?i)\bdone date:(\d+)`)
+	statRe       = regexp.MustCompile(`(?i)\bstat:(\S+)`)
+	errRe        = regexp.MustCompile(`(?i)\berr:(\S+)`)
+	textRe       = regexp.MustCompile(`(?i)\btext:(.*)$`)
+)
+
+// Receipt is a delivery receipt decoded from a deliver_sm, both from the
+// short_message text and the receipt TLVs.
+type Receipt struct {
+	ID                 string
+	Sub                int
+	Dlvrd              int
+	SubmitDate         time.Time
+	DoneDate           time.Time
+	Stat               string
+	Err                string
+	Text               string
+	ReceiptedMessageID string
+	MessageState       uint8
+	Intermediate       bool
+}
+
+// MessageID returns the id the receipt refers to, the receipted_message_id
+// TLV is preferred over the id: field of the text.
+func (r *Receipt) MessageID() string {
+	if r.ReceiptedMessageID != "" {
+		return r.ReceiptedMessageID
+	}
+	return r.ID
+}
+
+// State returns the final state of the message, taken from the stat: field
+// or derived from the message_state TLV.
+func (r *Receipt) State() string {
+	if r.Stat != "" {
+		return strings.ToUpper(r.Stat)
+	}
+	if s, ok := messageStates[r.MessageState]; ok {
+		return s
+	}
+	return "UNKNOWN"
+}
+
+// IsReceipt reports whether p is a deliver_sm carrying a delivery receipt.
+func IsReceipt(p pdu.Body) bool {
+	if p.Header().ID != pdu.DeliverSMID {
+		return false
+	}
+	if _, ok := p.TLVFields()[pdutlv.TagReceiptedMessageID]; ok {
+		return true
+	}
+	esm := p.Fields()[pdufield.ESMClass]
+	if esm == nil {
+		return false
+	}
+	t := esm.Bytes()[0] & esmTypeMask
+	return t == esmTypeDeliveryAck || t == esmTypeIntermediate
+}
+
+// Parse decodes the delivery receipt carried by p.
+func Parse(p pdu.Body) (*Receipt, error) {
+	if !IsReceipt(p) {
+		return nil, ErrNotReceipt
+	}
+	r := &Receipt{}
+	if esm := p.Fields()[pdufield.ESMClass]; esm != nil {
+		r.Intermediate = esm.Bytes()[0]&esmTypeMask == esmTypeIntermediate
+	}
+	if sm := p.Fields()[pdufield.ShortMessage]; sm != nil {
+		parseText(r, string(sm.Bytes()))
+	}
+	if f, ok := p.TLVFields()[pdutlv.TagReceiptedMessageID]; ok {
+		r.ReceiptedMessageID = f.String()
+	}
+	if f, ok := p.TLVFields()[TagMessageState]; ok && len(f.Bytes()) > 0 {
+		r.MessageState = f.Bytes()[0]
+	}
+	if r.MessageID() == "" {
+		return nil, errors.New("delivery receipt without message id")
+	}
+	return r, nil
+}
+
+func parseText(r *Receipt, text string) {
+	if m := idRe.FindStringSubmatch(text); m != nil {
+		r.ID = m[1]
+	}
+	if m := subRe.FindStringSubmatch(text); m != nil {
+		r.Sub, _ = strconv.Atoi(m[1])
+	}
+	if m := dlvrdRe.FindStringSubmatch(text); m != nil {
+		r.Dlvrd, _ = strconv.Atoi(m[1])
+	}
+	if m := submitDateRe.FindStringSubmatch(text); m != nil {
+		r.SubmitDate = parseDate(m[1])
+	}
+	if m := doneDateRe.FindStringSubmatch(text); m != nil {
+		r.DoneDate = parseDate(m[1])
+	}
+	if m := statRe.FindStringSubmatch(text); m != nil {
+		r.Stat = m[1]
+	}
+	if m := errRe.FindStringSubmatch(text); m != nil {
+		r.Err = m[1]
+	}
+	if m := textRe.FindStringSubmatch(text); m != nil {
+		r.Text = m[1]
+	}
+}
+
+// parseDate parses the YYMMDDhhmm receipt date, some SMSCs append seconds.
+func parseDate(s string) time.Time {
+	layout := "0601021504"
+	if len(s) == 12 {
+		layout = "060102150405"
+	}
+	t, err := time.Parse(layout, s)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// String formats the receipt text as in SMPP 3.4 appendix B.
+func (r *Receipt) String() string {
+	return fmt.Sprintf("id:%s sub:%03d dlvrd:%03d submit date:%s done date:%s stat:%s err:%s text:%s",
+		r.ID, r.Sub, r.Dlvrd, r.SubmitDate.Format("0601021504"), r.DoneDate.Format("0601021504"),
+		r.State(), r.Err, r.Text)
+}
+
+// NewDeliverSM builds a deliver_sm carrying the receipt, src and dst are
+// the receipt addresses, i.e. swapped from the original submit_sm.
+func NewDeliverSM(r *Receipt, src, dst string) pdu.Body {
+	p := pdu.NewDeliverSM()
+	f := p.Fields()
+	f.Set(pdufield.SourceAddr, src)
+	f.Set(pdufield.DestinationAddr, dst)
+	f.Set(pdufield.ESMClass, uint8(esmTypeDeliveryAck))
+	f.Set(pdufield.ShortMessage, r.String())
+	p.TLVFields().Set(pdutlv.TagReceiptedMessageID, pdutlv.CString(r.MessageID()))
+	state := r.MessageState
+	for k, v := range messageStates {
+		if v == r.State() {
+			state = k
+		}
+	}
+	if state != 0 {
+		p.TLVFields().Set(TagMessageState, state)
+	}
+	return p
+}
@@ -0,0 +1,82 @@
+package dlr_test
+
+import (
+	"testing"
+	"time"
+
+	gometrics "github.com/armon/go-metrics"
+	"github.com/sirupsen/logrus"
+	"github.com/skill215/go-smpp/smpp/pdu"
+	"github.com/skill215/go-smpp/smpp/pdu/pdufield"
+	"github.com/skill215/go-smpp/smpp/pdu/pdutlv"
+	"github.com/skill215/smpp-app/dlr"
+	"github.com/skill215/smpp-app/hdr"
+	"github.com/stretchr/testify/assert"
+)
+
+func newReceipt(text string) pdu.Body {
+	p := pdu.NewDeliverSM()
+	p.Fields().Set(pdufield.ESMClass, uint8(0x04))
+	p.Fields().Set(pdufield.ShortMessage, text)
+	return p
+}
+
+func TestParseReceipt(t *testing.T) {
+	p := newReceipt("id:0123456789 sub:001 dlvrd:001 submit date:2410181230 done date:241018123105 stat:DELIVRD err:000 text:hello world")
+	assert.True(t, dlr.IsReceipt(p))
+
+	r, err := dlr.Parse(p)
+	assert.Nil(t, err)
+	assert.Equal(t, "0123456789", r.MessageID())
+	assert.Equal(t, 1, r.Sub)
+	assert.Equal(t, 1, r.Dlvrd)
+	assert.Equal(t, time.Date(2024, 10, 18, 12, 30, 0, 0, time.UTC), r.SubmitDate)
+	assert.Equal(t, time.Date(2024, 10, 18, 12, 31, 5, 0, time.UTC), r.DoneDate)
+	assert.Equal(t, "DELIVRD", r.State())
+	assert.Equal(t, "000", r.Err)
+	assert.Equal(t, "hello world", r.Text)
+}
+
+func TestParseReceiptTLV(t *testing.T) {
+	p := pdu.NewDeliverSM()
+	p.TLVFields().Set(pdutlv.TagReceiptedMessageID, pdutlv.CString("abc"))
+	p.TLVFields().Set(dlr.TagMessageState, uint8(5))
+
+	r, err := dlr.Parse(p)
+	assert.Nil(t, err)
+	assert.Equal(t, "abc", r.MessageID())
+	assert.Equal(t, "UNDELIV", r.State())
+}
+
+func TestParseNotReceipt(t *testing.T) {
+	p := pdu.NewDeliverSM()
+	p.Fields().Set(pdufield.ShortMessage, "an MO message")
+	assert.False(t, dlr.IsReceipt(p))
+	_, err := dlr.Parse(p)
+	assert.Equal(t, dlr.ErrNotReceipt, err)
+}
+
+func TestTrackerMatch(t *testing.T) {
+	inm := gometrics.NewInmemSink(time.Second, time.Minute)
+	tracker := dlr.NewTracker(logrus.New(), inm)
+
+	latency := hdr.New()
+	tracker.Submitted("1", time.Now().Add(-time.Second), time.Minute, latency)
+	r, _ := dlr.Parse(newReceipt("id:1 stat:DELIVRD"))
+	tracker.Receipt(r, 10*time.Second)
+
+	// receipt before its submit_sm_resp is still matched
+	r, _ = dlr.Parse(newReceipt("id:2 stat:UNDELIV"))
+	tracker.Receipt(r, 10*time.Second)
+	tracker.Submitted("2", time.Now(), time.Minute, latency)
+
+	tracker.Submitted("3", time.Now(), time.Minute, nil)
+
+	stats := tracker.Stats()
+	assert.Equal(t, 2, stats.Matched)
+	assert.Equal(t, 1, stats.Pending)
+	assert.Equal(t, 1, stats.States["DELIVRD"])
+	assert.Equal(t, 1, stats.States["UNDELIV"])
+	assert.Equal(t, uint64(2), latency.Snapshot().Count)
+	assert.InDelta(t, 1000, latency.Snapshot().Max, 50)
+}
@@ -0,0 +1,235 @@
+package dlr
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+
+	gometrics "github.com/armon/go-metrics"
+	"github.com/sirupsen/logrus"
+	"github.com/skill215/smpp-app/hdr"
+)
+
+type submitted struct {
+	at time.Time
+	// submit to receipt latency of the sending group, may be nil
+	latency *hdr.Histogram
+	expiry  *expiry
+}
+
+type early struct {
+	receipt *Receipt
+	at      time.Time
+	expiry  *expiry
+}
+
+// expiry is when a message id stops waiting, in a deadline queue.
+type expiry struct {
+	id       string
+	deadline time.Time
+	index    int
+}
+
+// deadlines is a min-heap of expiries by deadline, so the entries due are
+// found without scanning the others.
+type deadlines []*expiry
+
+func (q deadlines) Len() int           { return len(q) }
+func (q deadlines) Less(i, j int) bool { return q[i].deadline.Before(q[j].deadline) }
+func (q deadlines) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *deadlines) Push(x interface{}) {
+	e := x.(*expiry)
+	e.index = len(*q)
+	*q = append(*q, e)
+}
+
+func (q *deadlines) Pop() interface{} {
+	old := *q
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return e
+}
+
+// add queues id until deadline.
+func (q *deadlines) add(id string, deadline time.Time) *expiry {
+	e := &expiry{id: id, deadline: deadline}
+	heap.Push(q, e)
+	return e
+}
+
+// remove takes e out of the queue.
+func (q *deadlines) remove(e *expiry) {
+	heap.Remove(q, e.index)
+}
+
+// due pops the next expiry with a deadline before now, nil if none is.
+func (q *deadlines) due(now time.Time) *expiry {
+	if len(*q) == 0 || !now.After((*q)[0].deadline) {
+		return nil
+	}
+	return heap.Pop(q).(*expiry)
+}
+
+// Stats are the totals since the tracker was created.
+type Stats struct {
+	Pending int            `json:"pending"`
+	Matched int            `json:"matched"`
+	Orphan  int            `json:"orphan"`
+	Missing int            `json:"missing"`
+	States  map[string]int `json:"states"`
+}
+
+// Tracker correlates delivery receipts with the message ids returned in
+// submit_sm_resp. Receipts may arrive on any bind, so one tracker is shared
+// by all clients.
+type Tracker struct {
+	sync.Mutex
+	log     *logrus.Logger
+	inm     *gometrics.InmemSink
+	pending map[string]submitted
+	early   map[string]early
+	// pending and early by deadline
+	pendingQ deadlines
+	earlyQ   deadlines
+	stats    Stats
+}
+
+func NewTracker(log *logrus.Logger, inm *gometrics.InmemSink) *Tracker {
+	return &Tracker{
+		log:     log,
+		inm:     inm,
+		pending: map[string]submitted{},
+		early:   map[string]early{},
+		stats:   Stats{States: map[string]int{}},
+	}
+}
+
+// Submitted registers a message id from a submit_sm_resp of a submit_sm
+// sent at, a receipt is expected within timeout. The submit to receipt
+// latency is recorded in latency unless it is nil.
+func (t *Tracker) Submitted(id string, at time.Time, timeout time.Duration, latency *hdr.Histogram) {
+	if id == "" {
+		return
+	}
+	s := submitted{at: at, latency: latency}
+	deadline := time.Now().Add(timeout)
+	t.Lock()
+	defer t.Unlock()
+	if e, ok := t.early[id]; ok {
+		delete(t.early, id)
+		t.earlyQ.remove(e.expiry)
+		t.match(id, e.receipt, s, e.at)
+		return
+	}
+	if prev, ok := t.pending[id]; ok {
+		// an id the SMSC returned again waits from now on
+		t.pendingQ.remove(prev.expiry)
+	}
+	s.expiry = t.pendingQ.add(id, deadline)
+	t.pending[id] = s
+}
+
+// Receipt matches a parsed receipt against the submitted messages. A
+// receipt matching none waits up to grace for its submit_sm_resp before it
+// is counted as orphan, a fast SMSC may deliver the receipt first.
+func (t *Tracker) Receipt(r *Receipt, grace time.Duration) {
+	id := r.MessageID()
+	now := time.Now()
+	t.Lock()
+	defer t.Unlock()
+	if r.Intermediate {
+		t.log.WithFields(logrus.Fields{
+			"id":    id,
+			"state": r.State(),
+		}).Debug("Intermediate delivery receipt")
+		return
+	}
+	s, ok := t.pending[id]
+	if !ok {
+		if prev, ok := t.early[id]; ok {
+			t.earlyQ.remove(prev.expiry)
+		}
+		t.early[id] = early{receipt: r, at: now, expiry: t.earlyQ.add(id, now.Add(grace))}
+		return
+	}
+	delete(t.pending, id)
+	t.pendingQ.remove(s.expiry)
+	t.match(id, r, s, now)
+}
+
+func (t *Tracker) match(id string, r *Receipt, s submitted, receivedAt time.Time) {
+	state := r.State()
+	latency := receivedAt.Sub(s.at)
+	if s.latency != nil {
+		s.latency.Record(latency)
+	}
+	t.stats.Matched++
+	t.stats.States[state]++
+	t.inm.IncrCounter([]string{"dlr"}, 1)
+	t.inm.IncrCounter([]string{"dlr " + state}, 1)
+	t.inm.AddSample([]string{"dlr latency"}, float32(latency.Milliseconds()))
+	t.log.WithFields(logrus.Fields{
+		"id":      id,
+		"state":   state,
+		"err":     r.Err,
+		"latency": latency,
+	}).Debug("Delivery receipt matched")
+}
+
+// Run expires pending messages without receipt and receipts without a
+// submitted message until ctx is done.
+func (t *Tracker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			t.expire(now)
+		}
+	}
+}
+
+// expire takes out the entries due at now, in deadline order, without
+// looking at the others.
+func (t *Tracker) expire(now time.Time) {
+	t.Lock()
+	defer t.Unlock()
+	for x := t.pendingQ.due(now); x != nil; x = t.pendingQ.due(now) {
+		delete(t.pending, x.id)
+		t.stats.Missing++
+		t.inm.IncrCounter([]string{"dlr missing"}, 1)
+		t.log.WithField("id", x.id).Debug("Delivery receipt missing")
+	}
+	for x := t.earlyQ.due(now); x != nil; x = t.earlyQ.due(now) {
+		e := t.early[x.id]
+		delete(t.early, x.id)
+		t.stats.Orphan++
+		t.inm.IncrCounter([]string{"dlr orphan"}, 1)
+		t.log.WithFields(logrus.Fields{
+			"id":    x.id,
+			"state": e.receipt.State(),
+		}).Debug("Orphan delivery receipt")
+	}
+}
+
+// Stats returns a copy of the tracker totals.
+func (t *Tracker) Stats() Stats {
+	t.Lock()
+	defer t.Unlock()
+	s := t.stats
+	s.Pending = len(t.pending)
+	s.States = map[string]int{}
+	for k, v := range t.stats.States {
+		s.States[k] = v
+	}
+	return s
+}
@@ -0,0 +1,40 @@
+package dlr
+
+import (
+	"testing"
+	"time"
+
+	gometrics "github.com/armon/go-metrics"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrackerExpire(t *testing.T) {
+	tracker := NewTracker(logrus.New(), gometrics.NewInmemSink(time.Second, time.Minute))
+	now := time.Now()
+
+	tracker.Submitted("late", now, 3*time.Second, nil)
+	tracker.Submitted("soon", now, time.Second, nil)
+	tracker.Submitted("matched", now, time.Second, nil)
+	tracker.Submitted("resent", now, time.Second, nil)
+	tracker.Submitted("resent", now, time.Hour, nil)
+	tracker.Receipt(&Receipt{ID: "matched", Stat: "DELIVRD"}, 5*time.Second)
+	tracker.Receipt(&Receipt{ID: "orphan", Stat: "DELIVRD"}, 5*time.Second)
+
+	tracker.expire(now.Add(2 * time.Second))
+	stats := tracker.Stats()
+	assert.Equal(t, 1, stats.Missing)
+	assert.Equal(t, 2, stats.Pending)
+	assert.Equal(t, 0, stats.Orphan)
+	assert.Len(t, tracker.pendingQ, 2)
+
+	tracker.expire(now.Add(6 * time.Second))
+	stats = tracker.Stats()
+	assert.Equal(t, 2, stats.Missing)
+	assert.Equal(t, 1, stats.Pending)
+	assert.Equal(t, 1, stats.Orphan)
+	assert.Equal(t, 1, stats.Matched)
+	assert.Len(t, tracker.pendingQ, 1)
+	assert.Empty(t, tracker.earlyQ)
+	assert.Empty(t, tracker.early)
+}
@@ -0,0 +1,145 @@
+// Package hdr records latencies in a log-linear histogram in the manner of
+// HdrHistogram: every value is kept with a relative error below 1%, from a
+// microsecond up, in constant memory per power of two.
+package hdr
+
+import (
+	"math"
+	"math/bits"
+	"sync"
+	"time"
+)
+
+const (
+	// values below subCount are exact, each power of two above is split
+	// in half sub buckets, so a bucket is at most 1/half of its value wide
+	subBits  = 8
+	subCount = 1 << subBits
+	half     = subCount / 2
+)
+
+// Histogram counts durations at microsecond resolution.
+type Histogram struct {
+	mu     sync.Mutex
+	counts []uint64
+	total  uint64
+	sum    uint64
+	max    uint64
+}
+
+func New() *Histogram {
+	return &Histogram{}
+}
+
+// index returns the bucket of v.
+func index(v uint64) int {
+	if v < subCount {
+		return int(v)
+	}
+	// v is in [half<<b, subCount<<b), buckets are 1<<b wide
+	b := bits.Len64(v) - subBits
+	return subCount + (b-1)*half + int(v>>uint(b)) - half
+}
+
+// bounds returns the lowest value of bucket i and its width.
+func bounds(i int) (uint64, uint64) {
+	if i < subCount {
+		return uint64(i), 1
+	}
+	b := uint((i-subCount)/half + 1)
+	sub := uint64((i-subCount)%half + half)
+	return sub << b, 1 << b
+}
+
+// Record adds one duration, negative ones count as zero.
+func (h *Histogram) Record(d time.Duration) {
+	v := uint64(0)
+	if d > 0 {
+		v = uint64(d / time.Microsecond)
+	}
+	i := index(v)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if i >= len(h.counts) {
+		counts := make([]uint64, i+1)
+		copy(counts, h.counts)
+		h.counts = counts
+	}
+	h.counts[i]++
+	h.total++
+	h.sum += v
+	if v > h.max {
+		h.max = v
+	}
+}
+
+// Reset drops every recorded value.
+func (h *Histogram) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.counts = nil
+	h.total, h.sum, h.max = 0, 0, 0
+}
+
+// quantile returns the value at q, h must be locked.
+func (h *Histogram) quantile(q float64) uint64 {
+	if h.total == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(q * float64(h.total)))
+	if rank < 1 {
+		rank = 1
+	}
+	var seen uint64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			low, width := bounds(i)
+			// the middle of the bucket, never above the largest value
+			v := low + width/2
+			if v > h.max {
+				v = h.max
+			}
+			return v
+		}
+	}
+	return h.max
+}
+
+// Quantile returns the duration below which a share q of the values lie.
+func (h *Histogram) Quantile(q float64) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return time.Duration(h.quantile(q)) * time.Microsecond
+}
+
+// Snapshot is the summary of a histogram in milliseconds.
+type Snapshot struct {
+	Count uint64  `json:"count"`
+	Mean  float64 `json:"mean_ms"`
+	P50   float64 `json:"p50_ms"`
+	P90   float64 `json:"p90_ms"`
+	P99   float64 `json:"p99_ms"`
+	P999  float64 `json:"p999_ms"`
+	Max   float64 `json:"max_ms"`
+}
+
+// Snapshot summarizes the values recorded so far.
+func (h *Histogram) Snapshot() Snapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := Snapshot{Count: h.total}
+	if h.total == 0 {
+		return s
+	}
+	ms := func(us uint64) float64 {
+		return math.Round(float64(us)) / 1000
+	}
+	s.Mean = math.Round(float64(h.sum)/float64(h.total)) / 1000
+	s.P50 = ms(h.quantile(0.5))
+	s.P90 = ms(h.quantile(0.9))
+	s.P99 = ms(h.quantile(0.99))
+	s.P999 = ms(h.quantile(0.999))
+	s.Max = ms(h.max)
+	return s
+}
@@ -0,0 +1,54 @@
+package hdr
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndexBounds(t *testing.T) {
+	for _, v := range []uint64{0, 1, 255, 256, 257, 511, 512, 1000, 123456, 1 << 40} {
+		low, width := bounds(index(v))
+		assert.True(t, low <= v && v < low+width, "%d not in [%d, %d)", v, low, low+width)
+		// at most 1/128 of the value wide
+		assert.True(t, width == 1 || width*half <= v, "bucket of %d is %d wide", v, width)
+	}
+	// buckets are contiguous
+	for i := 0; i < 2000; i++ {
+		low, width := bounds(i)
+		next, _ := bounds(i + 1)
+		assert.Equal(t, low+width, next, "bucket %d", i)
+	}
+}
+
+func TestQuantiles(t *testing.T) {
+	h := New()
+	values := make([]time.Duration, 0, 10000)
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		d := time.Duration(rnd.ExpFloat64()*20) * time.Millisecond
+		values = append(values, d)
+		h.Record(d)
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	for _, q := range []float64{0.5, 0.9, 0.99, 0.999} {
+		want := values[int(q*float64(len(values)))-1]
+		got := h.Quantile(q)
+		assert.InEpsilon(t, float64(want), float64(got), 0.01, "p%v", q*100)
+	}
+	s := h.Snapshot()
+	assert.Equal(t, uint64(10000), s.Count)
+	assert.Equal(t, float64(values[len(values)-1].Microseconds())/1000, s.Max)
+}
+
+func TestEmptyAndReset(t *testing.T) {
+	h := New()
+	assert.Equal(t, Snapshot{}, h.Snapshot())
+	h.Record(5 * time.Millisecond)
+	assert.Equal(t, 5.0, h.Snapshot().P99)
+	h.Reset()
+	assert.Equal(t, Snapshot{}, h.Snapshot())
+}
@@ -1,42 +1,171 @@
 package limiter
 
 import (
+	"context"
+	"sync"
 	"time"
 )
 
+// Limiter paces messages on a schedule: the next message is due one
+// interval of 1/rate after the last one, so a rate of 1000 per second lets
+// a message through every millisecond instead of all at the start of the
+// second. Up to burst messages may go back to back after being idle.
+//
+// The schedule runs on virtual time. A waiter the timer wakes late is not
+// charged for it, the messages it fell behind on go out at once, so the rate
+// holds when the interval is shorter than the timer can sleep. The schedule
+// only starts again from the clock after nobody asked for a while. Limiter
+// is safe for concurrent use.
 type Limiter struct {
-	rate  int           // tps in a second
-	begin time.Time     // time start
-	cycle time.Duration // time recycle period
-	count int
+	mu    sync.Mutex
+	rate  float64 // messages per second
+	burst int
+	// when the next message is due, and when the last one went
+	next time.Time
+	last time.Time
+	// closed and replaced by Set to wake up Wait
+	changed chan struct{}
 }
 
+const (
+	// how long the limiter goes without a message and without a waiter
+	// before the schedule counts as idle
+	idleGap = 2 * time.Millisecond
+	// the most a waiter woken late makes up for
+	maxLag = 50 * time.Millisecond
+)
+
+// New returns a limiter allowing r messages per cycle with the given burst,
+// a burst below 1 counts as 1.
+func New(r int, cycle time.Duration, burst int) *Limiter {
+	l := &Limiter{}
+	l.SetBurst(burst)
+	l.Set(r, cycle)
+	return l
+}
+
+// Set changes the rate to r per cycle, a rate of 0 blocks every message.
+func (l *Limiter) Set(r int, cycle time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	old := l.rate
+	l.rate = 0
+	if r > 0 && cycle > 0 {
+		l.rate = float64(r) / cycle.Seconds()
+	}
+	now := time.Now()
+	switch {
+	case old == 0:
+		// nothing was sent while stopped
+		l.last = time.Time{}
+	case l.rate > 0 && l.next.After(now):
+		// the messages already scheduled ahead are spaced at the new rate
+		l.next = now.Add(time.Duration(float64(l.next.Sub(now)) * old / l.rate))
+	}
+	if l.changed != nil {
+		close(l.changed)
+	}
+	l.changed = make(chan struct{})
+}
+
+// SetBurst changes how many messages may go back to back, below 1 counts
+// as 1.
+func (l *Limiter) SetBurst(burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if burst < 1 {
+		burst = 1
+	}
+	l.burst = burst
+}
+
+// Rate returns the current rate in messages per second.
+func (l *Limiter) Rate() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// Allow lets a message through if one is due, without blocking.
 func (l *Limiter) Allow() bool {
-	if l.rate == 0 {
-		return false
-	}
-	if l.count == l.rate-1 {
-		now := time.Now()
-		if now.Sub(l.begin) >= l.cycle {
-			l.Reset(now)
-			return true
-		} else {
-			return false
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, ok := l.take(time.Now(), false)
+	return ok
+}
+
+// Wait blocks until a message is due or ctx is done. While the rate is 0
+// it waits for the next Set.
+func (l *Limiter) Wait(ctx context.Context) error {
+	slept := false
+	for {
+		l.mu.Lock()
+		delay, ok := l.take(time.Now(), slept)
+		if ok {
+			l.mu.Unlock()
+			return nil
+		}
+		if l.changed == nil {
+			l.changed = make(chan struct{})
+		}
+		changed := l.changed
+		stopped := l.rate == 0
+		l.mu.Unlock()
+
+		if stopped {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-changed:
+			}
+			slept = false
+			continue
+		}
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-changed:
+			t.Stop()
+		case <-t.C:
 		}
-	} else {
-		l.count++
-		return true
+		slept = true
 	}
 }
 
-func (l *Limiter) Set(r int, cycle time.Duration) {
-	l.rate = r
-	l.begin = time.Now()
-	l.cycle = cycle
-	l.count = 0
+// take moves the schedule on by one message if one is due at now, or
+// returns how long until the next one is. slept tells that the caller waited
+// for the message, so it was not idle while the schedule fell behind. l.mu
+// must be held.
+func (l *Limiter) take(now time.Time, slept bool) (time.Duration, bool) {
+	if l.rate <= 0 {
+		return 0, false
+	}
+	if l.burst < 1 {
+		l.burst = 1
+	}
+	interval := l.interval()
+	if lag := now.Sub(l.next); lag > 0 {
+		switch {
+		case !slept && now.Sub(l.last) > idleGap:
+			// after an idle gap the schedule starts again from now
+			l.next = now
+		case lag > maxLag:
+			l.next = now.Add(-maxLag)
+		}
+	}
+	// burst-1 messages may be sent ahead of the schedule
+	early := l.next.Sub(now) - time.Duration(l.burst-1)*interval
+	if early > 0 {
+		return early, false
+	}
+	l.next = l.next.Add(interval)
+	l.last = now
+	return 0, true
 }
 
-func (l *Limiter) Reset(t time.Time) {
-	l.begin = t
-	l.count = 0
+// interval returns the time between two messages, l.rate must be above 0.
+func (l *Limiter) interval() time.Duration {
+	return time.Duration(float64(time.Second) / l.rate)
 }
@@ -0,0 +1,104 @@
+package limiter_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/skill215/smpp-app/limiter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWaitPacesEvenly(t *testing.T) {
+	l := limiter.New(100, time.Second, 1)
+	ctx := context.Background()
+
+	begin := time.Now()
+	last := begin
+	minGap := time.Hour
+	for i := 0; i < 20; i++ {
+		assert.Nil(t, l.Wait(ctx))
+		now := time.Now()
+		if gap := now.Sub(last); i > 0 && gap < minGap {
+			minGap = gap
+		}
+		last = now
+	}
+	// 20 messages at 100/s take about 200ms and are never sent back to back
+	elapsed := time.Since(begin)
+	assert.True(t, elapsed >= 180*time.Millisecond, "elapsed %v", elapsed)
+	assert.True(t, elapsed < 400*time.Millisecond, "elapsed %v", elapsed)
+	assert.True(t, minGap >= 5*time.Millisecond, "min gap %v", minGap)
+}
+
+func TestBurst(t *testing.T) {
+	l := limiter.New(10, time.Second, 5)
+	// let the bucket fill up
+	time.Sleep(550 * time.Millisecond)
+	for i := 0; i < 5; i++ {
+		assert.True(t, l.Allow(), "token %d", i)
+	}
+	assert.False(t, l.Allow())
+}
+
+func TestZeroRateBlocksUntilSet(t *testing.T) {
+	l := limiter.New(0, time.Second, 1)
+	assert.False(t, l.Allow())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, l.Wait(ctx))
+
+	done := make(chan error)
+	go func() { done <- l.Wait(context.Background()) }()
+	time.Sleep(20 * time.Millisecond)
+	l.Set(1000, time.Second)
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Wait not woken by Set")
+	}
+}
+
+func TestConcurrentUse(t *testing.T) {
+	l := limiter.New(1000, time.Second, 10)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	count := 0
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for l.Wait(ctx) == nil {
+				mu.Lock()
+				count++
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		l.Set(1000+i, time.Second)
+		time.Sleep(5 * time.Millisecond)
+	}
+	wg.Wait()
+	// about 200 tokens in 200ms plus the burst
+	assert.True(t, count > 100 && count <= 230, "count %d", count)
+}
+
+func TestWaitHoldsHighRate(t *testing.T) {
+	// the interval is shorter than the timer sleeps, the waiter makes up for
+	// waking late instead of losing the rest of the interval
+	l := limiter.New(5000, time.Second, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	count := 0
+	for l.Wait(ctx) == nil {
+		count++
+	}
+	assert.InDelta(t, 2500, count, 2500*0.03)
+}
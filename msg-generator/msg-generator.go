@@ -7,12 +7,14 @@ import (
 	"os"
 	"strings"
 	"sync"
-	"time"
+	"sync/atomic"
 
 	"github.com/sirupsen/logrus"
 	"github.com/skill215/go-smpp/smpp"
 	"github.com/skill215/go-smpp/smpp/pdu/pdufield"
 	"github.com/skill215/go-smpp/smpp/pdu/pdutext"
+	"github.com/skill215/go-smpp/smpp/pdu/pdutlv"
+	"github.com/skill215/smpp-app/coding"
 	"github.com/skill215/smpp-app/config"
 )
 
@@ -25,6 +27,20 @@ type MsgGenerator struct {
 	urlContents  []string
 	useRandom    bool
 	rnd          *rand.Rand
+	// csv generate-type, nil with rcptErr set when the file failed to open
+	recipients *RecipientList
+	rcptErr    error
+	// parsed send.templates, picked by weight
+	templates      []*template
+	templateWeight *weighted
+	// {seq} of the last message
+	seq uint64
+	// national language tables GSM7 may use, nil for none, and whether
+	// they are preferred over latin1 rather than only over ucs2
+	languages      []*coding.Language
+	preferNational bool
+	submit         *submitParams
+	tlvs           []*tlv
 }
 
 func New(conf *config.MessageConfig) *MsgGenerator {
@@ -37,15 +53,61 @@ func New(conf *config.MessageConfig) *MsgGenerator {
 		conf:      conf,
 		stop:      stop,
 		useRandom: false,
-		rnd:       rand.New(rand.NewSource(time.Now().UnixNano())),
+		rnd:       newRand(),
+		submit:    newSubmitParams(conf.Send.SubmitSM),
+		tlvs:      newTLVs(conf.Send.TLVs),
 	}
 
 	// Load file contents
 	mg.loadFileContents()
 
+	switch lang := strings.ToLower(conf.Send.NationalLanguage); lang {
+	case "none":
+	case "", "auto":
+		mg.languages = coding.Languages
+	default:
+		if l := coding.LanguageByName(lang); l != nil {
+			mg.languages = []*coding.Language{l}
+			mg.preferNational = true
+		}
+	}
+
+	if len(conf.Send.Templates) > 0 {
+		weights := make([]int, 0, len(conf.Send.Templates))
+		for _, t := range conf.Send.Templates {
+			mg.templates = append(mg.templates, parseTemplate(t.Content))
+			weights = append(weights, t.Weight)
+		}
+		mg.templateWeight = newWeighted(weights)
+	}
+
+	if strings.EqualFold(conf.Send.Dst.Daddr.GenerateType, "csv") {
+		mg.recipients, mg.rcptErr = OpenRecipients(conf.Send.Dst.Daddr, mg.rnd)
+		if mg.rcptErr != nil {
+			logrus.WithError(mg.rcptErr).WithField("file", conf.Send.Dst.Daddr.File).Error("Error reading recipient list")
+		}
+	}
+
 	return mg
 }
 
+// Recipients returns how much of the recipient list was used, nil unless
+// the destination addresses come from a csv file.
+func (mg *MsgGenerator) Recipients() *RecipientProgress {
+	if mg.recipients == nil {
+		return nil
+	}
+	p := mg.recipients.Progress()
+	return &p
+}
+
+// Close releases the recipient list.
+func (mg *MsgGenerator) Close() {
+	if mg.recipients != nil {
+		mg.recipients.Close()
+	}
+}
+
 func (mg *MsgGenerator) loadFileContents() {
 	// Read text file
 	if content, err := os.ReadFile(mg.conf.Send.TextFile); err != nil {
@@ -118,80 +180,156 @@ func (mg *MsgGenerator) GenerateMsgContent(ud string) string {
 	return ud
 }
 
-// detectDCS determines the appropriate Data Coding Scheme based on message content
-func detectDCS(content string) int {
-	for _, r := range content {
-		// Check for CJK characters (Chinese, Japanese, Korean)
-		if (r >= 0x4E00 && r <= 0x9FFF) || // CJK Unified Ideographs
-			(r >= 0x3040 && r <= 0x309F) || // Hiragana
-			(r >= 0x30A0 && r <= 0x30FF) || // Katakana
-			(r >= 0xAC00 && r <= 0xD7AF) || // Korean Hangul
-			(r >= 0x0590 && r <= 0x05FF) || // Hebrew
-			r > 0x7F { // Any other non-ASCII character
-			return 8 // Use UCS2 for Unicode characters
-		}
-	}
-
-	// Check if content contains extended Latin1 characters
-	for _, r := range content {
-		if r > 0x7F && r <= 0xFF {
-			return 3 // Use Latin1 for extended ASCII
-		}
-	}
-
-	return 0 // Default to GSM7 for basic ASCII
-}
-
-func (mg *MsgGenerator) GenerateMsg() *smpp.ShortMessage {
+// GenerateMsg returns the next message with its destination address and
+// submit_sm parameters. It fails with ErrRecipientsExhausted at the end of
+// a recipient list that does not loop.
+func (mg *MsgGenerator) GenerateMsg() (*Message, error) {
 	sms := smpp.ShortMessage{
 		SourceAddrTON: uint8(mg.conf.Send.Src.Ton),
 		SourceAddrNPI: uint8(mg.conf.Send.Src.Npi),
 		DestAddrTON:   uint8(mg.conf.Send.Dst.Ton),
 		DestAddrNPI:   uint8(mg.conf.Send.Dst.Npi),
 	}
-	content := mg.GenerateMsgContent(mg.conf.Send.Content)
-
-	// Detect appropriate DCS based on content
-	dcs := detectDCS(content)
-
-	// Add debug logging for message content and DCS
-	logrus.WithFields(logrus.Fields{
-		"content": content,
-		"dcs":     dcs,
-		"dcs_type": map[int]string{
-			0: "GSM7",
-			3: "Latin1",
-			4: "Binary",
-			8: "UCS2",
-		}[dcs],
-		"content_length": len(content),
-		"content_bytes":  len([]byte(content)),
-	}).Debug("Generated message content")
-
-	switch dcs {
-	case 0:
-		sms.Text = pdutext.GSM7(content)
-	case 3:
-		sms.Text = pdutext.Latin1(content)
-	case 4:
-		sms.Text = pdutext.Binary2(content)
-	case 8:
-		sms.Text = pdutext.UCS2(content)
-	default:
-		sms.Text = pdutext.Raw(content)
+	var rc *Recipient
+	if strings.EqualFold(mg.conf.Send.Dst.Daddr.GenerateType, "csv") {
+		if mg.recipients == nil {
+			return nil, fmt.Errorf("recipient list: %w", mg.rcptErr)
+		}
+		var err error
+		if rc, err = mg.recipients.Next(); err != nil {
+			return nil, err
+		}
+		sms.Dst = rc.Daddr
+		if rc.Ton != nil {
+			sms.DestAddrTON = *rc.Ton
+		}
+		if rc.Npi != nil {
+			sms.DestAddrNPI = *rc.Npi
+		}
+	} else {
+		sms.Dst = mg.GenerateDaddr()
 	}
 
 	if len(mg.conf.Send.Src.Oaddr) > 0 {
 		sms.Src = mg.conf.Send.Src.Oaddr
 	}
+	if rc != nil && rc.Oaddr != "" {
+		sms.Src = rc.Oaddr
+	}
+
+	// the content of the recipient, a template or the content mode
+	var tmpl *template
+	switch {
+	case rc != nil && rc.Content != "":
+		tmpl = parseTemplate(rc.Content)
+	case mg.templates != nil:
+		tmpl = mg.templates[mg.templateWeight.pick(mg.rnd)]
+	default:
+		tmpl = parseTemplate(mg.GenerateMsgContent(mg.conf.Send.Content))
+	}
+	ctx := &renderContext{
+		daddr: sms.Dst,
+		oaddr: sms.Src,
+		seq:   atomic.AddUint64(&mg.seq, 1),
+		rnd:   mg.rnd,
+	}
+	if rc != nil {
+		ctx.vars = rc.Vars
+	}
+	content := tmpl.render(ctx)
+	if len(mg.tlvs) > 0 {
+		sms.TLVFields = pdutlv.Fields{}
+		for _, t := range mg.tlvs {
+			sms.TLVFields[t.tag] = t.build(ctx)
+		}
+	}
+
+	// the cheapest coding taking every character, unless one is forced
+	dcs, forced := coding.Parse(mg.conf.Send.DataCoding)
+	if !forced {
+		dcs = coding.Select(content)
+	}
+
+	national := mg.national(content, dcs, forced)
+	if national != nil {
+		sms.Text = national
+	} else {
+		sms.Text = text(content, dcs)
+	}
+	// the length and segments are counted again for the log only
+	if logrus.IsLevelEnabled(logrus.DebugLevel) {
+		fields := logrus.Fields{
+			"content":  content,
+			"dcs":      dcs,
+			"dcs_type": coding.Name(dcs),
+			"forced":   forced,
+		}
+		if national != nil {
+			fields["national"] = nationalName(national)
+			fields["content_length"] = national.Length()
+			fields["segments"] = national.Segments()
+		} else {
+			fields["content_length"] = coding.Length(content, dcs)
+			fields["segments"] = coding.Segments(content, dcs)
+		}
+		logrus.WithFields(fields).Debug("Generated message content")
+	}
+
 	if mg.conf.Send.RequireSR {
 		sms.Register = pdufield.FinalDeliveryReceipt
 	} else {
 		sms.Register = pdufield.NoDeliveryReceipt
 	}
-	return &sms
+	msg := &Message{ShortMessage: &sms}
+	mg.submit.apply(msg, mg.rnd)
+	return msg, nil
+}
+
+// national returns content in GSM7 with national language tables when
+// they take characters the default alphabet lacks and dcs is ucs2 picked
+// for content, latin1 picked for it with a configured language or a
+// forced gsm7. It returns nil otherwise.
+func (mg *MsgGenerator) national(content string, dcs pdutext.DataCoding, forced bool) *coding.NationalText {
+	if mg.languages == nil {
+		return nil
+	}
+	switch {
+	case forced && dcs == coding.GSM7 && !coding.IsGSM7(content):
+	case !forced && dcs == coding.UCS2:
+	case !forced && dcs == coding.Latin1 && mg.preferNational:
+	default:
+		return nil
+	}
+	return coding.SelectNational(content, mg.languages)
+}
+
+// nationalName names the tables of t as locking/single.
+func nationalName(t *coding.NationalText) string {
+	name := func(l *coding.Language) string {
+		if l == nil {
+			return "default"
+		}
+		return l.Name
+	}
+	return name(t.Locking) + "/" + name(t.Single)
+}
+
+// text returns content encoded with dcs, characters it lacks are sent as
+// '?'.
+func text(content string, dcs pdutext.DataCoding) pdutext.Codec {
+	switch dcs {
+	case coding.GSM7:
+		return pdutext.GSM7(coding.ToGSM7(content))
+	case coding.Latin1:
+		return pdutext.Latin1(coding.ToLatin1(content))
+	case coding.Binary:
+		return pdutext.Binary2(content)
+	}
+	return pdutext.UCS2(content)
 }
 
+// GenerateDaddr returns a destination address built from prefix, number
+// and suffix, recipient lists are read by GenerateMsg.
 func (mg *MsgGenerator) GenerateDaddr() string {
 	mg.Lock()
 	defer mg.Unlock()
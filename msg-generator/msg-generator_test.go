@@ -4,7 +4,11 @@ import (
 	"testing"
 
 	"github.com/go-playground/assert/v2"
+	"github.com/skill215/go-smpp/smpp/pdu/pdufield"
 	"github.com/skill215/go-smpp/smpp/pdu/pdutext"
+	"github.com/skill215/go-smpp/smpp/pdu/pdutlv"
+	"github.com/skill215/smpp-app/coding"
+	"github.com/skill215/smpp-app/config"
 )
 
 func TestConvert7to8(t *testing.T) {
@@ -36,3 +40,86 @@ func TestConvertlatin1ToUCS2(t *testing.T) {
 		assert.Equal(t, ucs2Bytes[i*2], byte(0))
 	}
 }
+
+func TestNationalLanguage(t *testing.T) {
+	generate := func(content, dataCoding, language string) pdutext.Codec {
+		conf := &config.MessageConfig{}
+		conf.Send.Content = content
+		conf.Send.DataCoding = dataCoding
+		conf.Send.NationalLanguage = language
+		msg, err := New(conf).GenerateMsg()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return msg.Text
+	}
+	// Turkish tables instead of ucs2
+	nt, ok := generate("Işık şimdi", "auto", "auto").(*coding.NationalText)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, "turkish", nt.Locking.Name)
+	assert.Equal(t, pdutext.UCS2Type, generate("Işık", "auto", "none").Type())
+	// latin1 is kept unless a language is configured
+	assert.Equal(t, pdutext.Latin1Type, generate("canción", "auto", "auto").Type())
+	nt, ok = generate("canción", "auto", "spanish").(*coding.NationalText)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, "spanish", nt.Single.Name)
+	// a forced gsm7 uses the tables too
+	_, ok = generate("Işık", "gsm7", "auto").(*coding.NationalText)
+	assert.Equal(t, true, ok)
+}
+
+func TestSubmitParams(t *testing.T) {
+	conf := &config.MessageConfig{}
+	conf.Send.Content = "hello"
+	conf.Send.RequireSR = true
+	conf.Send.SubmitSM = config.SubmitParams{
+		ServiceType:              config.Choice{{Value: "CMT", Weight: 1}},
+		ESMClass:                 config.Choice{{Value: "0x02", Weight: 1}},
+		ProtocolID:               config.Choice{{Value: "0", Weight: 0}, {Value: "0x40", Weight: 1}},
+		PriorityFlag:             config.Choice{{Value: "1", Weight: 1}},
+		ScheduleDeliveryTime:     config.Choice{{Value: "10m", Weight: 1}},
+		ValidityPeriod:           config.Choice{{Value: "2030-01-02T03:04:05Z", Weight: 1}},
+		ReplaceIfPresent:         config.Choice{{Value: "1", Weight: 1}},
+		SMDefaultMsgID:           config.Choice{{Value: "7", Weight: 1}},
+		SMEAck:                   config.Choice{{Value: "both", Weight: 1}},
+		IntermediateNotification: config.Choice{{Value: "true", Weight: 1}},
+	}
+	msg, err := New(conf).GenerateMsg()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "CMT", msg.ServiceType)
+	assert.Equal(t, uint8(0x02), msg.ESMClass)
+	assert.Equal(t, uint8(0x40), msg.ProtocolID)
+	assert.Equal(t, uint8(1), msg.PriorityFlag)
+	assert.Equal(t, "000000001000000R", msg.ScheduleDeliveryTime)
+	assert.Equal(t, "300102030405000+", msg.ValidityPeriod)
+	assert.Equal(t, uint8(1), msg.ReplaceIfPresentFlag)
+	assert.Equal(t, uint8(7), msg.SMDefaultMsgID)
+	// final receipt, both SME acknowledgements and intermediate notification
+	assert.Equal(t, pdufield.DeliverySetting(0x1D), msg.Register)
+}
+
+func TestTLVs(t *testing.T) {
+	conf := &config.MessageConfig{}
+	conf.Send.Content = "hello"
+	conf.Send.Dst.Daddr.Prefix = "49"
+	conf.Send.Dst.Daddr.GenerateLen = 4
+	conf.Send.TLVs = []config.TLVConfig{
+		{Tag: "source_port", Type: "int16", Value: config.Choice{{Value: "0x1F90", Weight: 1}}},
+		{Tag: "user_message_reference", Type: "int8", Generator: "seq"},
+		{Tag: "0x1400", Type: "cstring", Value: config.Choice{{Value: "to {daddr}", Weight: 1}}},
+		{Tag: "0x1401", Type: "octets", Generator: "random", Length: 4},
+	}
+	mg := New(conf)
+	for i := 1; i <= 2; i++ {
+		msg, err := mg.GenerateMsg()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []byte{0x1F, 0x90}, msg.TLVFields[pdutlv.TagSourcePort])
+		assert.Equal(t, []byte{uint8(i)}, msg.TLVFields[pdutlv.TagUserMessageReference])
+		assert.Equal(t, []byte("to "+msg.Dst+"\x00"), msg.TLVFields[0x1400])
+		assert.Equal(t, 4, len(msg.TLVFields[0x1401].([]byte)))
+	}
+}
@@ -0,0 +1,314 @@
+package msggenerator
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"github.com/skill215/smpp-app/config"
+)
+
+// ErrRecipientsExhausted is returned once every row of a recipient list
+// that does not loop was used.
+var ErrRecipientsExhausted = errors.New("recipient list exhausted")
+
+// columns of a recipient list with a meaning of their own, any other
+// column is a variable of the row
+const (
+	colDaddr   = "daddr"
+	colTon     = "ton"
+	colNpi     = "npi"
+	colOaddr   = "oaddr"
+	colContent = "content"
+)
+
+// Recipient is one row of a recipient list, unset fields are taken from
+// the message config.
+type Recipient struct {
+	Daddr   string
+	Ton     *uint8
+	Npi     *uint8
+	Oaddr   string
+	Content string
+	// the other columns by header name
+	Vars map[string]string
+}
+
+// RecipientProgress is how much of a recipient list was used.
+type RecipientProgress struct {
+	File  string `json:"file"`
+	Order string `json:"order"`
+	Loop  bool   `json:"loop"`
+	// rows with an address
+	Total int `json:"total"`
+	// rows used in the current pass and their share of Total
+	Position int     `json:"position"`
+	Percent  float64 `json:"percent"`
+	// passes completed, only a looping list starts another one
+	Passes int `json:"passes"`
+	// rows used over all passes
+	Consumed  uint64 `json:"consumed"`
+	Exhausted bool   `json:"exhausted"`
+}
+
+// RecipientList hands out the rows of a CSV file one at a time. The file
+// may start with a header naming its columns, it must then have a daddr
+// column. Without one every row is an address in its first column. A
+// sequential list is streamed from the file, a shuffled one is read into
+// memory and shuffled again for every pass.
+type RecipientList struct {
+	mu      sync.Mutex
+	path    string
+	shuffle bool
+	loop    bool
+	rnd     *rand.Rand
+
+	header []string
+	daddr  int
+
+	// sequential
+	f *os.File
+	r *csv.Reader
+	// shuffle
+	rows [][]string
+	perm []int
+
+	total     int
+	position  int
+	passes    int
+	consumed  uint64
+	exhausted bool
+}
+
+// OpenRecipients opens the recipient list of conf, its rows are counted
+// before the first one is handed out.
+func OpenRecipients(conf config.AddrConfig, rnd *rand.Rand) (*RecipientList, error) {
+	l := &RecipientList{
+		path:    conf.File,
+		shuffle: strings.EqualFold(conf.Order, "shuffle"),
+		loop:    conf.Loop,
+		rnd:     rnd,
+	}
+	f, err := os.Open(conf.File)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := newCSVReader(f)
+	first, err := r.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%s: no recipients", conf.File)
+	}
+	if err != nil {
+		return nil, err
+	}
+	l.daddr = -1
+	for i, name := range first {
+		if strings.EqualFold(strings.TrimSpace(name), colDaddr) {
+			l.daddr = i
+		}
+	}
+	if l.daddr >= 0 {
+		for _, name := range first {
+			l.header = append(l.header, strings.ToLower(strings.TrimSpace(name)))
+		}
+	} else {
+		l.daddr = 0
+		if l.keep(first) {
+			l.rows = append(l.rows, first)
+		}
+	}
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if l.keep(row) {
+			l.rows = append(l.rows, row)
+		}
+	}
+	l.total = len(l.rows)
+	if l.total == 0 {
+		return nil, fmt.Errorf("%s: no recipients", conf.File)
+	}
+	if l.shuffle {
+		l.perm = l.rnd.Perm(l.total)
+	} else {
+		// streamed from the file from now on
+		l.rows = nil
+	}
+	return l, nil
+}
+
+func newCSVReader(r io.Reader) *csv.Reader {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	cr.Comment = '#'
+	return cr
+}
+
+// keep reports whether row has an address.
+func (l *RecipientList) keep(row []string) bool {
+	return l.daddr < len(row) && strings.TrimSpace(row[l.daddr]) != ""
+}
+
+// Next returns the next recipient, or ErrRecipientsExhausted at the end
+// of a list that does not loop.
+func (l *RecipientList) Next() (*Recipient, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.exhausted {
+		return nil, ErrRecipientsExhausted
+	}
+	if l.position == l.total {
+		l.passes++
+		l.position = 0
+		if !l.loop {
+			l.exhausted = true
+			l.close()
+			logrus.WithFields(logrus.Fields{
+				"file":  l.path,
+				"total": l.total,
+			}).Info("Recipient list exhausted")
+			return nil, ErrRecipientsExhausted
+		}
+		if l.shuffle {
+			l.perm = l.rnd.Perm(l.total)
+		} else {
+			l.close()
+		}
+	}
+	row, err := l.next()
+	if err != nil {
+		return nil, err
+	}
+	l.position++
+	l.consumed++
+	return l.recipient(row), nil
+}
+
+// next reads the row at position, l must be locked.
+func (l *RecipientList) next() ([]string, error) {
+	if l.shuffle {
+		return l.rows[l.perm[l.position]], nil
+	}
+	if l.r == nil {
+		f, err := os.Open(l.path)
+		if err != nil {
+			return nil, err
+		}
+		l.f, l.r = f, newCSVReader(f)
+		if l.header != nil {
+			if _, err := l.r.Read(); err != nil {
+				l.close()
+				return nil, err
+			}
+		}
+	}
+	for {
+		row, err := l.r.Read()
+		if err != nil {
+			// the file changed since it was opened
+			l.close()
+			if err == io.EOF {
+				err = fmt.Errorf("%s: fewer rows than counted", l.path)
+			}
+			return nil, err
+		}
+		if l.keep(row) {
+			return row, nil
+		}
+	}
+}
+
+func (l *RecipientList) recipient(row []string) *Recipient {
+	rc := &Recipient{Daddr: strings.TrimSpace(row[l.daddr])}
+	if l.header == nil {
+		return rc
+	}
+	for i, name := range l.header {
+		if i >= len(row) || i == l.daddr {
+			continue
+		}
+		v := strings.TrimSpace(row[i])
+		switch name {
+		case colTon:
+			rc.Ton = parseUint8(v)
+		case colNpi:
+			rc.Npi = parseUint8(v)
+		case colOaddr:
+			rc.Oaddr = v
+		case colContent:
+			rc.Content = row[i]
+		default:
+			if rc.Vars == nil {
+				rc.Vars = map[string]string{}
+			}
+			rc.Vars[name] = v
+		}
+	}
+	return rc
+}
+
+// parseUint8 returns nil for an empty or invalid value, which keeps the
+// configured one.
+func parseUint8(v string) *uint8 {
+	n, err := strconv.ParseUint(v, 10, 8)
+	if err != nil {
+		return nil
+	}
+	u := uint8(n)
+	return &u
+}
+
+// Progress returns how much of the list was used.
+func (l *RecipientList) Progress() RecipientProgress {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	order := "sequential"
+	if l.shuffle {
+		order = "shuffle"
+	}
+	p := RecipientProgress{
+		File:      l.path,
+		Order:     order,
+		Loop:      l.loop,
+		Total:     l.total,
+		Position:  l.position,
+		Passes:    l.passes,
+		Consumed:  l.consumed,
+		Exhausted: l.exhausted,
+	}
+	if l.exhausted {
+		p.Position = l.total
+	}
+	p.Percent = float64(int(float64(p.Position)*10000/float64(l.total))) / 100
+	return p
+}
+
+// Close releases the file of a sequential list, no more rows are handed
+// out afterwards.
+func (l *RecipientList) Close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.exhausted = true
+	l.close()
+}
+
+func (l *RecipientList) close() {
+	if l.f != nil {
+		l.f.Close()
+		l.f, l.r = nil, nil
+	}
+}
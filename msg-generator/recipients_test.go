@@ -0,0 +1,111 @@
+package msggenerator
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/skill215/smpp-app/config"
+)
+
+func writeList(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "recipients.csv")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRecipientsSequential(t *testing.T) {
+	path := writeList(t, "oaddr,daddr,ton,npi,name\nACME,111,1,1,Ann\n,222,,,Bob\n# comment\n,,,,\n333,,,\n")
+	l, err := OpenRecipients(config.AddrConfig{File: path, Order: "sequential"}, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	assert.Equal(t, 2, l.Progress().Total)
+
+	r, err := l.Next()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "111", r.Daddr)
+	assert.Equal(t, "ACME", r.Oaddr)
+	assert.Equal(t, uint8(1), *r.Ton)
+	assert.Equal(t, "Ann", r.Vars["name"])
+	assert.Equal(t, 50.0, l.Progress().Percent)
+
+	r, _ = l.Next()
+	assert.Equal(t, "222", r.Daddr)
+	assert.Equal(t, true, r.Ton == nil)
+
+	_, err = l.Next()
+	assert.Equal(t, ErrRecipientsExhausted, err)
+	p := l.Progress()
+	assert.Equal(t, true, p.Exhausted)
+	assert.Equal(t, uint64(2), p.Consumed)
+	assert.Equal(t, 1, p.Passes)
+}
+
+func TestRecipientsShuffleLoop(t *testing.T) {
+	// no header, one address per row
+	path := writeList(t, "1\n2\n3\n4\n")
+	l, err := OpenRecipients(config.AddrConfig{File: path, Order: "shuffle", Loop: true}, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for pass := 0; pass < 3; pass++ {
+		got := []string{}
+		for i := 0; i < 4; i++ {
+			r, err := l.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, r.Daddr)
+		}
+		sort.Strings(got)
+		assert.Equal(t, []string{"1", "2", "3", "4"}, got)
+	}
+	p := l.Progress()
+	assert.Equal(t, uint64(12), p.Consumed)
+	assert.Equal(t, 2, p.Passes)
+	assert.Equal(t, false, p.Exhausted)
+}
+
+func TestRecipientsSequentialLoop(t *testing.T) {
+	path := writeList(t, "daddr\n1\n2\n")
+	l, err := OpenRecipients(config.AddrConfig{File: path, Order: "sequential", Loop: true}, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	got := []string{}
+	for i := 0; i < 5; i++ {
+		r, err := l.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, r.Daddr)
+	}
+	assert.Equal(t, []string{"1", "2", "1", "2", "1"}, got)
+}
+
+func TestGenerateMsgFromRecipients(t *testing.T) {
+	path := writeList(t, "daddr,npi,content,code\n4912345,9,your code is {code},8812\n")
+	conf := &config.MessageConfig{}
+	conf.Send.Dst.Npi = 1
+	conf.Send.Dst.Daddr = config.AddrConfig{GenerateType: "csv", File: path, Order: "sequential"}
+	mg := New(conf)
+	defer mg.Close()
+	msg, err := mg.GenerateMsg()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "4912345", msg.Dst)
+	assert.Equal(t, uint8(9), msg.DestAddrNPI)
+	assert.Equal(t, "your code is 8812", string(msg.Text.Decode()))
+	_, err = mg.GenerateMsg()
+	assert.Equal(t, ErrRecipientsExhausted, err)
+	assert.Equal(t, 100.0, mg.Recipients().Percent)
+}
@@ -0,0 +1,104 @@
+package msggenerator
+
+import (
+	"math/rand"
+	"strconv"
+
+	"github.com/skill215/go-smpp/smpp"
+	"github.com/skill215/go-smpp/smpp/pdu/pdufield"
+	"github.com/skill215/smpp-app/config"
+)
+
+// Message is a generated short message with the submit_sm fields
+// smpp.ShortMessage has no room for.
+type Message struct {
+	*smpp.ShortMessage
+	// validity_period in the SMPP time format, absolute or relative,
+	// empty for the default of the SMSC
+	ValidityPeriod string
+}
+
+// choice picks one of the values of a config.Choice by weight, values
+// were checked by the config validation.
+type choice struct {
+	values []string
+	weight *weighted
+}
+
+func newChoice(c config.Choice) *choice {
+	if len(c) == 0 {
+		return nil
+	}
+	ch := &choice{}
+	weights := make([]int, 0, len(c))
+	for _, v := range c {
+		ch.values = append(ch.values, v.Value)
+		weights = append(weights, v.Weight)
+	}
+	ch.weight = newWeighted(weights)
+	return ch
+}
+
+// pick returns a value, empty for an unset parameter.
+func (c *choice) pick(rnd *rand.Rand) string {
+	if c == nil {
+		return ""
+	}
+	if len(c.values) == 1 {
+		return c.values[0]
+	}
+	return c.values[c.weight.pick(rnd)]
+}
+
+func (c *choice) uint8(rnd *rand.Rand) uint8 {
+	v, _ := config.ParseUint8(c.pick(rnd))
+	return v
+}
+
+// submitParams are the parsed config.SubmitParams of a message config.
+type submitParams struct {
+	serviceType          *choice
+	esmClass             *choice
+	protocolID           *choice
+	priorityFlag         *choice
+	scheduleDeliveryTime *choice
+	validityPeriod       *choice
+	replaceIfPresent     *choice
+	smDefaultMsgID       *choice
+	smeAck               *choice
+	intermediate         *choice
+}
+
+func newSubmitParams(p config.SubmitParams) *submitParams {
+	return &submitParams{
+		serviceType:          newChoice(p.ServiceType),
+		esmClass:             newChoice(p.ESMClass),
+		protocolID:           newChoice(p.ProtocolID),
+		priorityFlag:         newChoice(p.PriorityFlag),
+		scheduleDeliveryTime: newChoice(p.ScheduleDeliveryTime),
+		validityPeriod:       newChoice(p.ValidityPeriod),
+		replaceIfPresent:     newChoice(p.ReplaceIfPresent),
+		smDefaultMsgID:       newChoice(p.SMDefaultMsgID),
+		smeAck:               newChoice(p.SMEAck),
+		intermediate:         newChoice(p.IntermediateNotification),
+	}
+}
+
+// apply sets the picked parameters on msg, the registered_delivery bits
+// are added to the SMSC receipt already set.
+func (p *submitParams) apply(msg *Message, rnd *rand.Rand) {
+	sm := msg.ShortMessage
+	sm.ServiceType = p.serviceType.pick(rnd)
+	sm.ESMClass = p.esmClass.uint8(rnd)
+	sm.ProtocolID = p.protocolID.uint8(rnd)
+	sm.PriorityFlag = p.priorityFlag.uint8(rnd)
+	sm.ScheduleDeliveryTime, _ = config.SMPPTime(p.scheduleDeliveryTime.pick(rnd))
+	msg.ValidityPeriod, _ = config.SMPPTime(p.validityPeriod.pick(rnd))
+	sm.ReplaceIfPresentFlag = p.replaceIfPresent.uint8(rnd)
+	sm.SMDefaultMsgID = p.smDefaultMsgID.uint8(rnd)
+	ack, _ := config.ParseSMEAck(p.smeAck.pick(rnd))
+	sm.Register |= pdufield.DeliverySetting(ack)
+	if on, _ := strconv.ParseBool(p.intermediate.pick(rnd)); on {
+		sm.Register |= pdufield.DeliverySetting(config.IntermediateNotification)
+	}
+}
@@ -0,0 +1,220 @@
+package msggenerator
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultDateLayout formats {date} without a layout.
+const defaultDateLayout = "2006-01-02 15:04:05"
+
+// words are the vocabulary of {words}.
+var words = strings.Fields(`lorem ipsum dolor sit amet consectetur adipiscing elit sed do
+eiusmod tempor incididunt ut labore et dolore magna aliqua enim ad minim veniam quis
+nostrud exercitation ullamco laboris nisi aliquip ex ea commodo consequat duis aute irure
+in reprehenderit voluptate velit esse cillum fugiat nulla pariatur excepteur sint occaecat
+cupidatat non proident sunt culpa qui officia deserunt mollit anim id est laborum`)
+
+// lockedSource makes a rand.Rand safe for the connections of a group
+// generating messages at the same time.
+type lockedSource struct {
+	mu  sync.Mutex
+	src rand.Source
+}
+
+func newRand() *rand.Rand {
+	return rand.New(&lockedSource{src: rand.NewSource(time.Now().UnixNano())})
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Int63()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.src.Seed(seed)
+}
+
+// placeholder is a {name} or {name:arg} of a template.
+type placeholder struct {
+	name string
+	arg  string
+}
+
+// template is a message content split into literal text and placeholders,
+// text[i] comes before placeholders[i].
+type template struct {
+	text         []string
+	placeholders []placeholder
+}
+
+// parseTemplate splits s at its placeholders, a { without } is text.
+func parseTemplate(s string) *template {
+	t := &template{}
+	for {
+		start := strings.IndexByte(s, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(s[start:], '}')
+		if end < 0 {
+			break
+		}
+		end += start
+		name, arg := s[start+1:end], ""
+		if i := strings.IndexByte(name, ':'); i >= 0 {
+			name, arg = name[:i], name[i+1:]
+		}
+		t.text = append(t.text, s[:start])
+		t.placeholders = append(t.placeholders, placeholder{name: name, arg: arg})
+		s = s[end+1:]
+	}
+	t.text = append(t.text, s)
+	return t
+}
+
+// renderContext is what the placeholders of one message are filled from.
+type renderContext struct {
+	daddr string
+	oaddr string
+	seq   uint64
+	vars  map[string]string
+	rnd   *rand.Rand
+}
+
+// render fills in every placeholder, unknown ones are kept as they are.
+func (t *template) render(ctx *renderContext) string {
+	if len(t.placeholders) == 0 {
+		return t.text[0]
+	}
+	var sb strings.Builder
+	for i, p := range t.placeholders {
+		sb.WriteString(t.text[i])
+		sb.WriteString(p.value(ctx))
+	}
+	sb.WriteString(t.text[len(t.text)-1])
+	return sb.String()
+}
+
+func (p placeholder) value(ctx *renderContext) string {
+	switch p.name {
+	case "daddr":
+		return ctx.daddr
+	case "oaddr":
+		return ctx.oaddr
+	case "seq":
+		return strconv.FormatUint(ctx.seq, 10)
+	case "uuid":
+		return uuid(ctx.rnd)
+	case "otp":
+		n, err := strconv.Atoi(p.arg)
+		if err != nil || n < 1 || n > 18 {
+			n = 6
+		}
+		return fmt.Sprintf("%0*d", n, ctx.rnd.Int63n(pow10(n)))
+	case "date":
+		layout := p.arg
+		if layout == "" {
+			layout = defaultDateLayout
+		}
+		return time.Now().Format(layout)
+	case "random url":
+		return GenerateRandomURL()
+	case "pick":
+		choices := strings.Split(p.arg, "|")
+		return choices[ctx.rnd.Intn(len(choices))]
+	case "words":
+		return randomWords(ctx.rnd, p.arg)
+	}
+	if v, ok := ctx.vars[p.name]; ok {
+		return v
+	}
+	if p.arg != "" {
+		return "{" + p.name + ":" + p.arg + "}"
+	}
+	return "{" + p.name + "}"
+}
+
+func pow10(n int) int64 {
+	v := int64(1)
+	for i := 0; i < n; i++ {
+		v *= 10
+	}
+	return v
+}
+
+// uuid returns a random version 4 UUID.
+func uuid(rnd *rand.Rand) string {
+	var b [16]byte
+	// not rnd.Read, which keeps state outside the locked source
+	binary.BigEndian.PutUint64(b[:8], rnd.Uint64())
+	binary.BigEndian.PutUint64(b[8:], rnd.Uint64())
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// randomWords returns arg words, arg is a count or a min-max range, 5
+// without one.
+func randomWords(rnd *rand.Rand, arg string) string {
+	lo, hi := 5, 5
+	if arg != "" {
+		from, to, isRange := strings.Cut(arg, "-")
+		var err error
+		if lo, err = strconv.Atoi(from); err != nil || lo < 1 {
+			lo = 5
+		}
+		hi = lo
+		if isRange {
+			if hi, err = strconv.Atoi(to); err != nil || hi < lo {
+				hi = lo
+			}
+		}
+	}
+	n := lo + rnd.Intn(hi-lo+1)
+	picked := make([]string, n)
+	for i := range picked {
+		picked[i] = words[rnd.Intn(len(words))]
+	}
+	return strings.Join(picked, " ")
+}
+
+// weighted picks an index in proportion to its weight.
+type weighted struct {
+	// running total of the weights
+	cum []int
+}
+
+func newWeighted(weights []int) *weighted {
+	w := &weighted{cum: make([]int, len(weights))}
+	total := 0
+	for i, weight := range weights {
+		if weight > 0 {
+			total += weight
+		}
+		w.cum[i] = total
+	}
+	return w
+}
+
+func (w *weighted) pick(rnd *rand.Rand) int {
+	total := w.cum[len(w.cum)-1]
+	if total <= 0 {
+		return 0
+	}
+	n := rnd.Intn(total)
+	for i, c := range w.cum {
+		if n < c {
+			return i
+		}
+	}
+	return len(w.cum) - 1
+}
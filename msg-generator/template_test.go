@@ -0,0 +1,63 @@
+package msggenerator
+
+import (
+	"math/rand"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/skill215/smpp-app/config"
+)
+
+func TestTemplateRender(t *testing.T) {
+	ctx := &renderContext{
+		daddr: "4912345",
+		oaddr: "ACME",
+		seq:   42,
+		vars:  map[string]string{"name": "Ann"},
+		rnd:   rand.New(rand.NewSource(1)),
+	}
+	render := func(s string) string { return parseTemplate(s).render(ctx) }
+
+	assert.Equal(t, "Hi Ann, 4912345 from ACME #42", render("Hi {name}, {daddr} from {oaddr} #{seq}"))
+	assert.Equal(t, "keep {unknown} and {x:y} and {open", render("keep {unknown} and {x:y} and {open"))
+	assert.MatchRegex(t, render("code {otp:4}"), "^code [0-9]{4}$")
+	assert.MatchRegex(t, render("{otp}"), "^[0-9]{6}$")
+	assert.MatchRegex(t, render("{uuid}"), "^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$")
+	assert.Equal(t, time.Now().Format("2006-01-02"), render("{date:2006-01-02}"))
+	assert.MatchRegex(t, render("{random url}"), "^https?://")
+	for i := 0; i < 20; i++ {
+		assert.MatchRegex(t, render("{pick:red|green|blue}"), "^(red|green|blue)$")
+		n := len(strings.Fields(render("{words:2-4}")))
+		assert.Equal(t, true, n >= 2 && n <= 4)
+	}
+	assert.Equal(t, 3, len(strings.Fields(render("{words:3}"))))
+}
+
+func TestWeightedTemplates(t *testing.T) {
+	conf := &config.MessageConfig{}
+	conf.Send.Templates = []config.MessageTemplate{
+		{Name: "otp", Weight: 6, Content: "otp {otp}"},
+		{Name: "promo", Weight: 3, Content: "promo {random url}"},
+		{Name: "off", Weight: 0, Content: "never"},
+		{Name: "long", Weight: 1, Content: "long"},
+	}
+	mg := New(conf)
+	counts := map[string]int{}
+	re := regexp.MustCompile(`^\w+`)
+	for i := 0; i < 10000; i++ {
+		msg, err := mg.GenerateMsg()
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[re.FindString(string(msg.Text.Decode()))]++
+	}
+	assert.Equal(t, 0, counts["never"])
+	for name, want := range map[string]int{"otp": 6000, "promo": 3000, "long": 1000} {
+		if d := counts[name] - want; d < -300 || d > 300 {
+			t.Errorf("%s: %d messages, want about %d", name, counts[name], want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package msggenerator
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/skill215/go-smpp/smpp/pdu/pdutlv"
+	"github.com/skill215/smpp-app/config"
+)
+
+// alphanumerics are the characters of a random cstring.
+const alphanumerics = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// tlv builds the value of a configured optional parameter for every
+// message, the config was validated.
+type tlv struct {
+	tag  pdutlv.Tag
+	typ  string
+	bits int
+	// picked by weight, cstring values are templates
+	value     *choice
+	templates []*template
+	generator string
+	length    int
+	// last value of the seq generator
+	seq uint64
+}
+
+func newTLVs(confs []config.TLVConfig) []*tlv {
+	tlvs := make([]*tlv, 0, len(confs))
+	for _, c := range confs {
+		tag, _ := config.ParseTag(c.Tag)
+		t := &tlv{
+			tag:       pdutlv.Tag(tag),
+			typ:       strings.ToLower(c.Type),
+			bits:      config.TLVBits(c.Type),
+			value:     newChoice(c.Value),
+			generator: strings.ToLower(c.Generator),
+			length:    c.Length,
+		}
+		if t.typ == "cstring" && t.value != nil {
+			for _, v := range t.value.values {
+				t.templates = append(t.templates, parseTemplate(v))
+			}
+		}
+		tlvs = append(tlvs, t)
+	}
+	return tlvs
+}
+
+// build returns the value of the parameter for the message of ctx.
+func (t *tlv) build(ctx *renderContext) []byte {
+	switch t.generator {
+	case "seq":
+		n := atomic.AddUint64(&t.seq, 1)
+		if t.bits > 0 {
+			// wraps around at the width of the type
+			return config.EncodeTLVInt(t.bits, n)
+		}
+		return append([]byte(strconv.FormatUint(n, 10)), 0)
+	case "random":
+		return t.random(ctx.rnd)
+	}
+	if t.templates != nil {
+		i := 0
+		if len(t.templates) > 1 {
+			i = t.value.weight.pick(ctx.rnd)
+		}
+		return append([]byte(t.templates[i].render(ctx)), 0)
+	}
+	v, _ := config.EncodeTLV(t.typ, t.value.pick(ctx.rnd))
+	return v
+}
+
+func (t *tlv) random(rnd *rand.Rand) []byte {
+	if t.bits > 0 {
+		return config.EncodeTLVInt(t.bits, rnd.Uint64())
+	}
+	b := make([]byte, t.length)
+	for i := range b {
+		if t.typ == "cstring" {
+			b[i] = alphanumerics[rnd.Intn(len(alphanumerics))]
+		} else {
+			b[i] = byte(rnd.Intn(256))
+		}
+	}
+	if t.typ == "cstring" {
+		b = append(b, 0)
+	}
+	return b
+}
@@ -0,0 +1,110 @@
+package profile
+
+import (
+	"math"
+	"time"
+
+	"github.com/skill215/smpp-app/config"
+)
+
+// PhaseRate returns the tps of a phase at offset t into it.
+func PhaseRate(ph config.ProfilePhase, t time.Duration) int {
+	if t < 0 {
+		t = 0
+	}
+	if t > ph.Duration {
+		t = ph.Duration
+	}
+	progress := 1.0
+	if ph.Duration > 0 {
+		progress = float64(t) / float64(ph.Duration)
+	}
+
+	switch ph.Type {
+	case "ramp":
+		return ph.From + int(math.Round(float64(ph.To-ph.From)*progress))
+	case "step":
+		steps := ph.Steps
+		if steps < 1 {
+			steps = 1
+		}
+		// steps+1 levels of equal length, From first and To last
+		level := int(progress * float64(steps+1))
+		if level > steps {
+			level = steps
+		}
+		return ph.From + (ph.To-ph.From)*level/steps
+	case "sine":
+		if ph.Period <= 0 {
+			return ph.Tps
+		}
+		tps := float64(ph.Tps) + float64(ph.Amplitude)*math.Sin(2*math.Pi*float64(t)/float64(ph.Period))
+		return int(math.Max(0, math.Round(tps)))
+	case "spike":
+		offset := t
+		if ph.Period > 0 {
+			offset = t % ph.Period
+		}
+		if offset < ph.SpikeLength {
+			return ph.Peak
+		}
+		return ph.Tps
+	default: // hold
+		return ph.Tps
+	}
+}
+
+// Position is where a profile is at some time after its start.
+type Position struct {
+	Phase   int
+	Type    string
+	Elapsed time.Duration // into the phase
+	Cycle   int           // completed repeats
+	Tps     int
+	Done    bool
+}
+
+// Duration returns the length of one pass over the phases.
+func Duration(p config.TrafficProfile) time.Duration {
+	var total time.Duration
+	for _, ph := range p.Phases {
+		total += ph.Duration
+	}
+	return total
+}
+
+// At returns the position of the profile at elapsed after its start. A
+// finished profile without repeat stays at the end of its last phase.
+func At(p config.TrafficProfile, elapsed time.Duration) Position {
+	total := Duration(p)
+	if len(p.Phases) == 0 || total <= 0 {
+		return Position{Done: true}
+	}
+	pos := Position{}
+	if elapsed >= total {
+		if !p.Repeat {
+			last := len(p.Phases) - 1
+			ph := p.Phases[last]
+			return Position{
+				Phase:   last,
+				Type:    ph.Type,
+				Elapsed: ph.Duration,
+				Tps:     PhaseRate(ph, ph.Duration),
+				Done:    true,
+			}
+		}
+		pos.Cycle = int(elapsed / total)
+		elapsed %= total
+	}
+	for i, ph := range p.Phases {
+		if elapsed < ph.Duration || i == len(p.Phases)-1 {
+			pos.Phase = i
+			pos.Type = ph.Type
+			pos.Elapsed = elapsed
+			pos.Tps = PhaseRate(ph, elapsed)
+			break
+		}
+		elapsed -= ph.Duration
+	}
+	return pos
+}
@@ -0,0 +1,80 @@
+package profile_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/skill215/smpp-app/config"
+	"github.com/skill215/smpp-app/profile"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPhaseRates(t *testing.T) {
+	ramp := config.ProfilePhase{Type: "ramp", Duration: 10 * time.Second, From: 100, To: 200}
+	assert.Equal(t, 100, profile.PhaseRate(ramp, 0))
+	assert.Equal(t, 150, profile.PhaseRate(ramp, 5*time.Second))
+	assert.Equal(t, 200, profile.PhaseRate(ramp, 10*time.Second))
+
+	step := config.ProfilePhase{Type: "step", Duration: 9 * time.Second, From: 0, To: 100, Steps: 2}
+	assert.Equal(t, 0, profile.PhaseRate(step, time.Second))
+	assert.Equal(t, 50, profile.PhaseRate(step, 4*time.Second))
+	assert.Equal(t, 100, profile.PhaseRate(step, 7*time.Second))
+
+	sine := config.ProfilePhase{Type: "sine", Duration: time.Minute, Tps: 100, Amplitude: 50, Period: 40 * time.Second}
+	assert.Equal(t, 100, profile.PhaseRate(sine, 0))
+	assert.Equal(t, 150, profile.PhaseRate(sine, 10*time.Second))
+	assert.Equal(t, 50, profile.PhaseRate(sine, 30*time.Second))
+
+	spike := config.ProfilePhase{Type: "spike", Duration: time.Minute, Tps: 10, Peak: 500, SpikeLength: 5 * time.Second, Period: 20 * time.Second}
+	assert.Equal(t, 500, profile.PhaseRate(spike, 2*time.Second))
+	assert.Equal(t, 10, profile.PhaseRate(spike, 6*time.Second))
+	assert.Equal(t, 500, profile.PhaseRate(spike, 21*time.Second))
+
+	hold := config.ProfilePhase{Type: "hold", Duration: time.Minute, Tps: 42}
+	assert.Equal(t, 42, profile.PhaseRate(hold, 30*time.Second))
+}
+
+func TestAt(t *testing.T) {
+	p := config.TrafficProfile{Phases: []config.ProfilePhase{
+		{Type: "ramp", Duration: 10 * time.Second, From: 0, To: 100},
+		{Type: "hold", Duration: 20 * time.Second, Tps: 100},
+	}}
+
+	pos := profile.At(p, 15*time.Second)
+	assert.Equal(t, 1, pos.Phase)
+	assert.Equal(t, "hold", pos.Type)
+	assert.Equal(t, 5*time.Second, pos.Elapsed)
+	assert.False(t, pos.Done)
+
+	pos = profile.At(p, time.Minute)
+	assert.True(t, pos.Done)
+	assert.Equal(t, 100, pos.Tps)
+
+	p.Repeat = true
+	pos = profile.At(p, 35*time.Second)
+	assert.False(t, pos.Done)
+	assert.Equal(t, 1, pos.Cycle)
+	assert.Equal(t, 0, pos.Phase)
+	assert.Equal(t, 50, pos.Tps)
+}
+
+func TestScheduler(t *testing.T) {
+	p := config.TrafficProfile{
+		Tick: 10 * time.Millisecond,
+		Phases: []config.ProfilePhase{
+			{Type: "hold", Duration: 30 * time.Millisecond, Tps: 10},
+			{Type: "hold", Duration: 30 * time.Millisecond, Tps: 20},
+		},
+	}
+	rates := make(chan int, 10)
+	s := profile.NewScheduler(p, func(tps int) { rates <- tps })
+	s.Start()
+	defer s.Stop()
+
+	assert.Equal(t, 10, <-rates)
+	assert.Equal(t, 20, <-rates)
+	time.Sleep(50 * time.Millisecond)
+	assert.True(t, s.State().Done)
+	assert.Equal(t, 20, s.Rate())
+	assert.Len(t, rates, 0)
+}
@@ -0,0 +1,118 @@
+package profile
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/skill215/smpp-app/config"
+)
+
+// State is the progress of a running profile returned by the REST API.
+type State struct {
+	Started       time.Time `json:"started"`
+	Phase         int       `json:"phase"`
+	Phases        int       `json:"phases"`
+	Type          string    `json:"type"`
+	PhaseElapsed  string    `json:"phase_elapsed"`
+	PhaseDuration string    `json:"phase_duration"`
+	Cycle         int       `json:"cycle"`
+	Tps           int       `json:"tps"`
+	Done          bool      `json:"done"`
+}
+
+// Scheduler recomputes the rate of a profile every tick and hands it to
+// set whenever it changes.
+type Scheduler struct {
+	profile config.TrafficProfile
+	set     func(tps int)
+	cancel  context.CancelFunc
+
+	mu    sync.Mutex
+	state State
+}
+
+func NewScheduler(p config.TrafficProfile, set func(tps int)) *Scheduler {
+	return &Scheduler{
+		profile: p,
+		set:     set,
+		state:   State{Phases: len(p.Phases), Tps: -1},
+	}
+}
+
+// Start runs the profile from its first phase until Stop or its end.
+func (s *Scheduler) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	begin := time.Now()
+	s.mu.Lock()
+	s.state.Started = begin
+	s.mu.Unlock()
+
+	// set is only called from this goroutine, never from Start
+	go func() {
+		if s.tick(begin, begin) {
+			return
+		}
+		tick := s.profile.Tick
+		if tick <= 0 {
+			tick = time.Second
+		}
+		ticker := time.NewTicker(tick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				if s.tick(begin, now) {
+					return
+				}
+			}
+		}
+	}()
+}
+
+// Stop ends the schedule, the last rate stays in effect. It does not wait
+// for a set call in progress.
+func (s *Scheduler) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+}
+
+// tick publishes the rate at now and reports whether the profile is done.
+func (s *Scheduler) tick(begin, now time.Time) bool {
+	if len(s.profile.Phases) == 0 {
+		return true
+	}
+	pos := At(s.profile, now.Sub(begin))
+	s.mu.Lock()
+	changed := pos.Tps != s.state.Tps
+	s.state.Phase = pos.Phase
+	s.state.Type = pos.Type
+	s.state.PhaseElapsed = pos.Elapsed.Truncate(time.Second).String()
+	s.state.PhaseDuration = s.profile.Phases[pos.Phase].Duration.String()
+	s.state.Cycle = pos.Cycle
+	s.state.Tps = pos.Tps
+	s.state.Done = pos.Done
+	s.mu.Unlock()
+	if changed {
+		s.set(pos.Tps)
+	}
+	return pos.Done
+}
+
+// State returns the current phase and rate.
+func (s *Scheduler) State() State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+// Rate returns the last rate handed to set, -1 before the first tick.
+func (s *Scheduler) Rate() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state.Tps
+}
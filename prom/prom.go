@@ -0,0 +1,249 @@
+// Package prom keeps labeled counters, gauges and histograms and writes
+// them in the Prometheus text exposition format.
+package prom
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets are latency buckets in seconds, from 1ms to 10s.
+var DefBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Registry holds the metric families exposed on a scrape.
+type Registry struct {
+	mu       sync.Mutex
+	families []*family
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+type family struct {
+	name    string
+	help    string
+	kind    string // counter, gauge or histogram
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+// series is one label combination of a family.
+type series struct {
+	mu     sync.Mutex
+	values []string
+	value  float64
+	// histograms only, counts per bucket without the +Inf one
+	counts []uint64
+	count  uint64
+}
+
+func (r *Registry) register(f *family) *family {
+	f.series = map[string]*series{}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, g := range r.families {
+		if g.name == f.name {
+			panic("prom: duplicate metric " + f.name)
+		}
+	}
+	r.families = append(r.families, f)
+	return f
+}
+
+func (f *family) with(values []string) *series {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("prom: %s takes %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s := f.series[key]
+	if s == nil {
+		s = &series{values: append([]string{}, values...)}
+		if f.kind == "histogram" {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+// CounterVec is a family of counters.
+type CounterVec struct{ f *family }
+
+// Counter only goes up.
+type Counter struct{ s *series }
+
+// Counter registers a counter family with the given label names.
+func (r *Registry) Counter(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{r.register(&family{name: name, help: help, kind: "counter", labels: labels})}
+}
+
+// With returns the counter of the label values, in label order.
+func (v *CounterVec) With(values ...string) *Counter {
+	return &Counter{v.f.with(values)}
+}
+
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+func (c *Counter) Add(d float64) {
+	if d < 0 {
+		return
+	}
+	c.s.mu.Lock()
+	c.s.value += d
+	c.s.mu.Unlock()
+}
+
+// GaugeVec is a family of gauges.
+type GaugeVec struct{ f *family }
+
+// Gauge is a value that goes up and down.
+type Gauge struct{ s *series }
+
+// Gauge registers a gauge family with the given label names.
+func (r *Registry) Gauge(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{r.register(&family{name: name, help: help, kind: "gauge", labels: labels})}
+}
+
+// With returns the gauge of the label values, in label order.
+func (v *GaugeVec) With(values ...string) *Gauge {
+	return &Gauge{v.f.with(values)}
+}
+
+func (g *Gauge) Set(val float64) {
+	g.s.mu.Lock()
+	g.s.value = val
+	g.s.mu.Unlock()
+}
+
+// HistogramVec is a family of histograms sharing their buckets.
+type HistogramVec struct{ f *family }
+
+// Histogram counts observations in cumulative buckets.
+type Histogram struct {
+	s       *series
+	buckets []float64
+}
+
+// Histogram registers a histogram family with the given upper bounds,
+// sorted ascending, and label names.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return &HistogramVec{r.register(&family{name: name, help: help, kind: "histogram", labels: labels, buckets: buckets})}
+}
+
+// With returns the histogram of the label values, in label order.
+func (v *HistogramVec) With(values ...string) *Histogram {
+	return &Histogram{v.f.with(values), v.f.buckets}
+}
+
+func (h *Histogram) Observe(val float64) {
+	i := sort.SearchFloat64s(h.buckets, val)
+	h.s.mu.Lock()
+	if i < len(h.s.counts) {
+		h.s.counts[i]++
+	}
+	h.s.count++
+	h.s.value += val
+	h.s.mu.Unlock()
+}
+
+// Write writes every family in the text exposition format, series sorted
+// by their label values.
+func (r *Registry) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	r.mu.Lock()
+	families := append([]*family{}, r.families...)
+	r.mu.Unlock()
+	for _, f := range families {
+		f.write(bw)
+	}
+	return bw.Flush()
+}
+
+func (f *family) write(w *bufio.Writer) {
+	f.mu.Lock()
+	series := make([]*series, 0, len(f.series))
+	for _, s := range f.series {
+		series = append(series, s)
+	}
+	f.mu.Unlock()
+	sort.Slice(series, func(i, j int) bool {
+		return strings.Join(series[i].values, "\xff") < strings.Join(series[j].values, "\xff")
+	})
+
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, escape(f.help, false))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind)
+	for _, s := range series {
+		s.mu.Lock()
+		if f.kind != "histogram" {
+			fmt.Fprintf(w, "%s%s %s\n", f.name, labels(f.labels, s.values, ""), number(s.value))
+			s.mu.Unlock()
+			continue
+		}
+		var cumulative uint64
+		for i, le := range f.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, labels(f.labels, s.values, number(le)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, labels(f.labels, s.values, "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", f.name, labels(f.labels, s.values, ""), number(s.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", f.name, labels(f.labels, s.values, ""), s.count)
+		s.mu.Unlock()
+	}
+}
+
+// labels formats the label set, with an le label for histogram buckets.
+func labels(names, values []string, le string) string {
+	if len(names) == 0 && le == "" {
+		return ""
+	}
+	pairs := make([]string, 0, len(names)+1)
+	for i, name := range names {
+		pairs = append(pairs, name+`="`+escape(values[i], true)+`"`)
+	}
+	if le != "" {
+		pairs = append(pairs, `le="`+le+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escape(s string, quote bool) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	if quote {
+		s = strings.ReplaceAll(s, `"`, `\"`)
+	}
+	return s
+}
+
+func number(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Handler serves the registry to Prometheus scrapes.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.Write(w)
+	})
+}
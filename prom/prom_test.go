@@ -0,0 +1,49 @@
+package prom
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrite(t *testing.T) {
+	r := NewRegistry()
+	submits := r.Counter("smpp_submit_sm_total", "submit_sm sent.", "account", "conn")
+	submits.With("smpp1", "1").Add(2)
+	submits.With("smpp1", "0").Inc()
+	r.Gauge("smpp_bind_up", "Bound connections.", "account").With(`a"b`).Set(1)
+	latency := r.Histogram("smpp_latency_seconds", "Latency.", []float64{0.01, 0.1}, "conn")
+	h := latency.With("0")
+	h.Observe(0.005)
+	h.Observe(0.05)
+	h.Observe(1)
+
+	var b bytes.Buffer
+	assert.Nil(t, r.Write(&b))
+	assert.Equal(t, `# HELP smpp_submit_sm_total submit_sm sent.
+# TYPE smpp_submit_sm_total counter
+smpp_submit_sm_total{account="smpp1",conn="0"} 1
+smpp_submit_sm_total{account="smpp1",conn="1"} 2
+# HELP smpp_bind_up Bound connections.
+# TYPE smpp_bind_up gauge
+smpp_bind_up{account="a\"b"} 1
+# HELP smpp_latency_seconds Latency.
+# TYPE smpp_latency_seconds histogram
+smpp_latency_seconds_bucket{conn="0",le="0.01"} 1
+smpp_latency_seconds_bucket{conn="0",le="0.1"} 2
+smpp_latency_seconds_bucket{conn="0",le="+Inf"} 3
+smpp_latency_seconds_sum{conn="0"} 1.055
+smpp_latency_seconds_count{conn="0"} 3
+`, b.String())
+}
+
+func TestSameSeries(t *testing.T) {
+	r := NewRegistry()
+	v := r.Counter("c", "", "l")
+	v.With("x").Inc()
+	v.With("x").Inc()
+	var b bytes.Buffer
+	r.Write(&b)
+	assert.Contains(t, b.String(), `c{l="x"} 2`)
+}
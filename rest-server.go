@@ -3,28 +3,49 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
+	"reflect"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	gometrics "github.com/armon/go-metrics"
 	"github.com/sirupsen/logrus"
 	log "github.com/sirupsen/logrus"
-	"github.com/skill215/smpp-app/broker"
 	"github.com/skill215/smpp-app/config"
+	"github.com/skill215/smpp-app/hdr"
 	"github.com/skill215/smpp-app/logger"
+	"github.com/skill215/smpp-app/prom"
 	smppclient "github.com/skill215/smpp-app/smpp-client"
+	"github.com/skill215/smpp-app/smsc"
+	"github.com/skill215/smpp-app/web"
+	yaml "gopkg.in/yaml.v3"
 )
 
 var (
 	handler         *smppclient.SmppHandler
-	b               *broker.Broker
 	MetricsInterval = 5
+	inm             *gometrics.InmemSink
+	// Prometheus metrics served on /metrics
+	registry *prom.Registry
+	// SMPP connection metrics, latency percentiles included
+	metrics *smppclient.Metrics
+
+	// live configuration served and replaced by /api/config
+	confLock sync.Mutex
+	appConf  *config.AppConfig
 )
 
+// maxConfigSize limits the body of POST /api/config.
+const maxConfigSize = 1 << 20
+
 func printUsage() {
 	fmt.Println("SMPP Application REST Server")
 	fmt.Println("\nUsage:")
@@ -34,26 +55,62 @@ func printUsage() {
 	fmt.Println("        Configuration file path (default: smpp-app.yaml)")
 	fmt.Println("  -server-port uint")
 	fmt.Println("        REST server port (overrides port in config file)")
+	fmt.Println("  -mode string")
+	fmt.Println("        client: SMPP clients and REST server (default)")
+	fmt.Println("        smsc: only the mock SMSC from the smsc config section")
+	fmt.Println("        both: mock SMSC, SMPP clients and REST server")
 	fmt.Println("\nExample:")
 	fmt.Println("  Start with default configuration:")
 	fmt.Println("    ./rest-server -c config/smpp-app.yaml")
 	fmt.Println("  Start with custom REST port:")
 	fmt.Println("    ./rest-server -c config/smpp-app.yaml -server-port 8082")
+	fmt.Println("  Start end to end against the mock SMSC:")
+	fmt.Println("    ./rest-server -c config/smpp-app-local.yaml -mode both")
 	fmt.Println("\nAPI Endpoints:")
-	fmt.Println("  /startLoop?tps=<number>  Start sending messages with specified TPS")
-	fmt.Println("  /stopLoop                Stop sending messages")
+	fmt.Println("  /api/startloop?tps=<number>  Start sending messages with specified TPS")
+	fmt.Println("  /api/stoploop                Stop sending messages")
+	fmt.Println("  GET /api/config              Show the live configuration, passwords redacted (?format=json)")
+	fmt.Println("  POST /api/config             Replace the configuration (application/yaml or json)")
+	fmt.Println("  POST /api/tps?group=<name|index>&tps=<number>[&conn=<index>]")
+	fmt.Println("                               Set the total TPS of a group, or of one connection")
+	fmt.Println("  GET /api/tps                 Effective TPS of every group")
+	fmt.Println("  POST /api/profile?group=<name|index>")
+	fmt.Println("                               Run a traffic profile (application/yaml) on a group")
+	fmt.Println("  DELETE /api/profile?group=<name|index>")
+	fmt.Println("                               Stop the traffic profile of a group")
+	fmt.Println("  GET /api/profile             Current phase of every running profile")
+	fmt.Println("  GET /api/status              Traffic state and bind state of every connection")
+	fmt.Println("  GET /api/connections[?group=<name|index>]")
+	fmt.Println("                               Registry of the connections and how many are bound")
+	fmt.Println("  POST /api/connections?group=<name|index>&action=<unbind|rebind|close|pause|resume>[&conn=<index>]")
+	fmt.Println("                               Act on one connection of a group, or on all of them")
+	fmt.Println("  GET /api/metrics             Counters of the last metrics interval")
+	fmt.Println("  GET /api/latency             Latency percentiles of every group since start or reset")
+	fmt.Println("  DELETE /api/latency          Reset the latency percentiles")
+	fmt.Println("  GET /api/failures            Submit failures of every group by command_status since start or reset")
+	fmt.Println("  DELETE /api/failures         Reset the submit failures")
+	fmt.Println("  GET /metrics                 Prometheus metrics")
+	fmt.Println("  /                            Web GUI")
 	fmt.Println("\nMetrics:")
 	fmt.Printf("  Metrics are printed every %d seconds showing:\n", MetricsInterval)
 	fmt.Println("    ao: Number of messages sent")
 	fmt.Println("    ao failure: Number of failed messages")
+	fmt.Println("    ao timeout: Number of submit_sm without response")
+	fmt.Println("    ao error: Number of submit_sm lost on a failed connection")
+	fmt.Println("    ao failure.<status>: Number of failed messages by command_status, e.g. ESME_RTHROTTLED")
+	fmt.Println("    ao backoff: Number of rate cuts on throttling responses")
 	fmt.Println("    at: Number of messages received")
 	fmt.Println("    at failure: Number of failed receives")
+	fmt.Println("    recipients: Rows of a csv recipient list used in the current pass")
+	fmt.Println("    submit latency: submit_sm to submit_sm_resp percentiles of a group")
+	fmt.Println("    receipt latency: submit_sm to delivery receipt percentiles of a group")
 }
 
 func main() {
 	flag.Usage = printUsage
 	confPath := flag.String("c", "smpp-app.yaml", "configuration file path")
 	serverPort := flag.Uint("server-port", 0, "REST server port (overrides config file)")
+	mode := flag.String("mode", "client", "client, smsc or both")
 	flag.Parse()
 
 	if len(os.Args) == 1 {
@@ -86,25 +143,38 @@ func main() {
 		conf.App.Rest.Port = uint16(*serverPort)
 	}
 
-	log.Debug("Starting rest-server...")
+	// start the mock SMSC before the clients bind to it
+	if *mode == "smsc" || *mode == "both" {
+		srv := smsc.New(conf.App.Smsc, logrus.StandardLogger())
+		if err := srv.Listen(conf.GetSmscAddr()); err != nil {
+			log.WithError(err).Fatal("Failed to start mock SMSC")
+		}
+		if *mode == "smsc" {
+			srv.Serve()
+			return
+		}
+		go srv.Serve()
+	}
 
-	b = broker.NewBroker()
-	go b.Start()
-	log.Debug("Broker started")
+	log.Debug("Starting rest-server...")
 
 	// start metrics
-	inm := gometrics.NewInmemSink(time.Duration(MetricsInterval)*time.Second, time.Minute)
+	inm = gometrics.NewInmemSink(time.Duration(MetricsInterval)*time.Second, time.Minute)
 	gometrics.NewGlobal(gometrics.DefaultConfig("smpp-app"), inm)
 	go printMetrics(inm)
+	registry = prom.NewRegistry()
+	metrics = smppclient.NewMetrics(registry)
 	log.Debug("Metrics initialized")
 
 	// init smpp handler
-	handler = smppclient.ProvideService(ctx, logrus.StandardLogger(), conf.App.SmppConn, b, inm)
+	handler = smppclient.ProvideService(ctx, logrus.StandardLogger(), conf.App.SmppConn, inm, metrics)
 	if err != nil {
 		log.Fatal(err)
 	}
-	// start smpp app one by one
+	// start smpp app one by one, bind with 0 tps until a loop is started
 	handler.Init(ctx)
+	handler.Run(ctx, 0)
+	appConf = conf
 	addr := conf.GetRestAddr()
 	log.WithFields(logrus.Fields{
 		"rest_addr": conf.App.Rest.Addr,
@@ -114,6 +184,18 @@ func main() {
 
 	http.HandleFunc("/startLoop", startLoop)
 	http.HandleFunc("/stopLoop", stopLoop)
+	http.HandleFunc("/api/startloop", startLoop)
+	http.HandleFunc("/api/stoploop", stopLoop)
+	http.HandleFunc("/api/config", configHandler)
+	http.HandleFunc("/api/status", getStatus)
+	http.HandleFunc("/api/connections", connectionsHandler)
+	http.HandleFunc("/api/tps", tpsHandler)
+	http.HandleFunc("/api/profile", profileHandler)
+	http.HandleFunc("/api/metrics", getMetrics)
+	http.HandleFunc("/api/latency", latencyHandler)
+	http.HandleFunc("/api/failures", failuresHandler)
+	http.Handle("/metrics", registry.Handler())
+	http.Handle("/", web.Handler())
 	log.Debug("HTTP endpoints registered")
 	log.Fatal(http.ListenAndServe(addr, nil))
 }
@@ -126,8 +208,8 @@ func startLoop(w http.ResponseWriter, r *http.Request) {
 	}).Debug("Received startLoop request")
 
 	tps, err := strconv.Atoi(r.FormValue("tps"))
-	if err != nil {
-		log.WithError(err).Error("Invalid TPS parameter")
+	if err != nil || tps < 0 {
+		log.WithField("tps", r.FormValue("tps")).Error("Invalid TPS parameter")
 		JSONResp(w, map[string]string{"error": "Invalid TPS parameter"}, http.StatusBadRequest)
 		return
 	}
@@ -136,7 +218,8 @@ func startLoop(w http.ResponseWriter, r *http.Request) {
 		"tps": tps,
 	}).Debug("Starting message loop")
 
-	b.Publish(tps)
+	// binds the clients again if a previous stopLoop unbound them
+	handler.Start(context.Background(), tps)
 	JSONResp(w, map[string]string{"status": "started", "tps": strconv.Itoa(tps)}, http.StatusOK)
 }
 
@@ -146,13 +229,300 @@ func stopLoop(w http.ResponseWriter, r *http.Request) {
 		"path":   r.URL.Path,
 	}).Debug("Received stopLoop request")
 
-	b.Publish(0)
 	handler.Stop(context.Background())
 
 	log.Debug("Message loop stopped")
 	JSONResp(w, map[string]string{"status": "stopped"}, http.StatusOK)
 }
 
+func configHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		getConfig(w, r)
+	case http.MethodPost:
+		postConfig(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		JSONResp(w, map[string]string{"error": "method not allowed"}, http.StatusMethodNotAllowed)
+	}
+}
+
+func getConfig(w http.ResponseWriter, r *http.Request) {
+	confLock.Lock()
+	out, err := yaml.Marshal(appConf.Redact())
+	confLock.Unlock()
+	if err != nil {
+		log.WithError(err).Error("Failed to encode config")
+		JSONResp(w, map[string]string{"error": err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	if r.FormValue("format") == "json" {
+		// the same keys as the YAML, so the GUI can post it back as is
+		var doc interface{}
+		if err := yaml.Unmarshal(out, &doc); err != nil {
+			JSONResp(w, map[string]string{"error": err.Error()}, http.StatusInternalServerError)
+			return
+		}
+		JSONResp(w, doc, http.StatusOK)
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(out)
+}
+
+// postConfig validates and applies a new YAML config, or its JSON form. Message settings are
+// applied in place, groups whose connection changed are rebuilt. The REST
+// and mock SMSC sections are stored but only take effect after a restart.
+func postConfig(w http.ResponseWriter, r *http.Request) {
+	log.WithFields(log.Fields{
+		"method": r.Method,
+		"path":   r.URL.Path,
+	}).Debug("Received config update")
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxConfigSize+1))
+	if err != nil {
+		JSONResp(w, map[string]string{"error": err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxConfigSize {
+		JSONResp(w, map[string]string{"error": "config too large"}, http.StatusRequestEntityTooLarge)
+		return
+	}
+	conf, err := config.ParseSmppConf(body)
+	if err != nil {
+		var verr *config.ValidationError
+		if errors.As(err, &verr) {
+			log.WithError(err).Warn("Rejected invalid config")
+			JSONResp(w, map[string]interface{}{"error": "invalid config", "fields": verr.Fields}, http.StatusBadRequest)
+			return
+		}
+		JSONResp(w, map[string]string{"error": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	confLock.Lock()
+	defer confLock.Unlock()
+	if err := conf.KeepPasswords(appConf); err != nil {
+		log.WithError(err).Warn("Rejected config with unknown redacted passwords")
+		JSONResp(w, map[string]interface{}{"error": "invalid config", "fields": err.(*config.ValidationError).Fields}, http.StatusBadRequest)
+		return
+	}
+	restart := []string{}
+	if conf.App.Rest != appConf.App.Rest {
+		restart = append(restart, "service.rest")
+	}
+	if !reflect.DeepEqual(conf.App.Smsc, appConf.App.Smsc) {
+		restart = append(restart, "service.smsc")
+	}
+	if level, err := logrus.ParseLevel(conf.App.Log.Level); err == nil {
+		log.SetLevel(level)
+	}
+	updated, rebuilt := handler.Apply(conf.App.SmppConn)
+	appConf = conf
+
+	resp := map[string]interface{}{
+		"status":  "updated",
+		"updated": updated,
+		"rebuilt": rebuilt,
+	}
+	if len(restart) > 0 {
+		resp["restart_required"] = restart
+	}
+	JSONResp(w, resp, http.StatusOK)
+}
+
+func tpsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		JSONResp(w, handler.Rates(), http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		JSONResp(w, map[string]string{"error": "method not allowed"}, http.StatusMethodNotAllowed)
+		return
+	}
+
+	tps, err := strconv.Atoi(r.FormValue("tps"))
+	if err != nil || tps < 0 {
+		JSONResp(w, map[string]string{"error": "Invalid TPS parameter"}, http.StatusBadRequest)
+		return
+	}
+	conn := -1
+	if v := r.FormValue("conn"); v != "" {
+		if conn, err = strconv.Atoi(v); err != nil {
+			JSONResp(w, map[string]string{"error": "Invalid conn parameter"}, http.StatusBadRequest)
+			return
+		}
+	}
+	rate, err := handler.SetGroupTps(r.FormValue("group"), conn, tps)
+	if err != nil {
+		JSONResp(w, map[string]string{"error": err.Error()}, http.StatusBadRequest)
+		return
+	}
+	JSONResp(w, rate, http.StatusOK)
+}
+
+func profileHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		JSONResp(w, handler.Profiles(), http.StatusOK)
+	case http.MethodPost:
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxConfigSize))
+		if err != nil {
+			JSONResp(w, map[string]string{"error": err.Error()}, http.StatusBadRequest)
+			return
+		}
+		p := config.TrafficProfile{}
+		if err := yaml.Unmarshal(body, &p); err != nil {
+			JSONResp(w, map[string]string{"error": err.Error()}, http.StatusBadRequest)
+			return
+		}
+		if err := p.Validate(); err != nil {
+			var verr *config.ValidationError
+			if errors.As(err, &verr) {
+				JSONResp(w, map[string]interface{}{"error": "invalid profile", "fields": verr.Fields}, http.StatusBadRequest)
+				return
+			}
+			JSONResp(w, map[string]string{"error": err.Error()}, http.StatusBadRequest)
+			return
+		}
+		if err := handler.StartProfile(r.URL.Query().Get("group"), p); err != nil {
+			JSONResp(w, map[string]string{"error": err.Error()}, http.StatusBadRequest)
+			return
+		}
+		JSONResp(w, map[string]string{"status": "started"}, http.StatusOK)
+	case http.MethodDelete:
+		if err := handler.StopProfile(r.FormValue("group")); err != nil {
+			JSONResp(w, map[string]string{"error": err.Error()}, http.StatusBadRequest)
+			return
+		}
+		JSONResp(w, map[string]string{"status": "stopped"}, http.StatusOK)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		JSONResp(w, map[string]string{"error": "method not allowed"}, http.StatusMethodNotAllowed)
+	}
+}
+
+func getStatus(w http.ResponseWriter, r *http.Request) {
+	JSONResp(w, handler.Status(), http.StatusOK)
+}
+
+func connectionsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		conns, err := handler.Connections(r.FormValue("group"))
+		if err != nil {
+			JSONResp(w, map[string]string{"error": err.Error()}, http.StatusBadRequest)
+			return
+		}
+		JSONResp(w, conns, http.StatusOK)
+	case http.MethodPost:
+		conn := -1
+		if v := r.FormValue("conn"); v != "" {
+			var err error
+			if conn, err = strconv.Atoi(v); err != nil {
+				JSONResp(w, map[string]string{"error": "Invalid conn parameter"}, http.StatusBadRequest)
+				return
+			}
+		}
+		group, action := r.FormValue("group"), r.FormValue("action")
+		if err := handler.Control(group, conn, action); err != nil {
+			JSONResp(w, map[string]string{"error": err.Error()}, http.StatusBadRequest)
+			return
+		}
+		JSONResp(w, map[string]interface{}{"status": "requested", "group": group, "conn": conn, "action": action}, http.StatusOK)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		JSONResp(w, map[string]string{"error": "method not allowed"}, http.StatusMethodNotAllowed)
+	}
+}
+
+// metricValue is a counter or sample of the last metrics interval.
+type metricValue struct {
+	Count int     `json:"count"`
+	Sum   float64 `json:"sum"`
+	Rate  float64 `json:"rate"`
+	Mean  float64 `json:"mean"`
+	Max   float64 `json:"max"`
+}
+
+func getMetrics(w http.ResponseWriter, r *http.Request) {
+	resp := map[string]interface{}{
+		"interval_seconds": MetricsInterval,
+		"receipts":         handler.ReceiptStats(),
+		"binds":            handler.BindRates(),
+		"latency":          metrics.Latency(),
+		"failures":         metrics.Failures(),
+	}
+	counters := map[string]metricValue{}
+	samples := map[string]metricValue{}
+	if interval := lastInterval(inm); interval != nil {
+		interval.RLock()
+		resp["interval"] = interval.Interval
+		for _, c := range interval.Counters {
+			counters[metricName(c.Name)] = metricValue{Count: c.Count, Sum: c.Sum, Rate: c.Rate, Mean: c.AggregateSample.Mean(), Max: c.Max}
+		}
+		for _, s := range interval.Samples {
+			samples[metricName(s.Name)] = metricValue{Count: s.Count, Sum: s.Sum, Rate: s.Rate, Mean: s.AggregateSample.Mean(), Max: s.Max}
+		}
+		interval.RUnlock()
+	}
+	resp["counters"] = counters
+	resp["samples"] = samples
+	JSONResp(w, resp, http.StatusOK)
+}
+
+func latencyHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		JSONResp(w, metrics.Latency(), http.StatusOK)
+	case http.MethodDelete:
+		metrics.ResetLatency()
+		JSONResp(w, map[string]string{"status": "reset"}, http.StatusOK)
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		JSONResp(w, map[string]string{"error": "method not allowed"}, http.StatusMethodNotAllowed)
+	}
+}
+
+func failuresHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		JSONResp(w, metrics.Failures(), http.StatusOK)
+	case http.MethodDelete:
+		metrics.ResetFailures()
+		JSONResp(w, map[string]string{"status": "reset"}, http.StatusOK)
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		JSONResp(w, map[string]string{"error": "method not allowed"}, http.StatusMethodNotAllowed)
+	}
+}
+
+// metricName undoes the "_" the sink puts for spaces, e.g. "ao_failure",
+// in the part of a name before the first ".". The part after it is kept
+// as is, e.g. "ao_failure.ESME_RTHROTTLED" is "ao failure.ESME_RTHROTTLED".
+func metricName(name string) string {
+	if i := strings.Index(name, "."); i >= 0 {
+		return strings.ReplaceAll(name[:i], "_", " ") + name[i:]
+	}
+	return strings.ReplaceAll(name, "_", " ")
+}
+
+// lastInterval returns the most recent finished interval, or the current
+// one if it is all we have.
+func lastInterval(inm *gometrics.InmemSink) *gometrics.IntervalMetrics {
+	data := inm.Data()
+	switch n := len(data); n {
+	case 0:
+		return nil
+	case 1:
+		return data[0]
+	default:
+		return data[n-2]
+	}
+}
+
 // Send Json in http response
 func JSONResp(w http.ResponseWriter, resp interface{}, code int) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
@@ -168,34 +538,80 @@ func printMetrics(inm *gometrics.InmemSink) {
 	ticker := time.NewTicker(5 * time.Second)
 	for {
 		<-ticker.C
-		data := inm.Data()
-		var interval *gometrics.IntervalMetrics
-		n := len(data)
-		switch {
-		case n == 0:
+		interval := lastInterval(inm)
+		if interval == nil {
 			log.Debug("No metrics data available")
-			return
-		case n == 1:
-			// Show the current interval if it's all we have
-			interval = data[0]
-		default:
-			// Show the most recent finished interval if we have one
-			interval = data[n-2]
+			continue
 		}
 
 		result := interval.Interval.String()
 		output := map[string]int{}
 		for _, counter := range interval.Counters {
-			output[counter.Name] = counter.Count
+			// the sum, "ao segment" grows by the parts of a message
+			output[metricName(counter.Name)] = int(counter.Sum)
 		}
-		for _, m := range []string{"ao", "ao failure", "at", "at failure"} {
+		for _, m := range []string{"ao", "ao message", "ao segment", "ao failure", "ao timeout", "ao error", "ao backoff", "at", "at failure", "dlr", "dlr missing", "dlr orphan"} {
 			val, ok := output[m]
 			if !ok {
 				val = 0
 			}
 			result += fmt.Sprintf(" %s:%d ", m, val)
 		}
+		// receipts by final state, e.g. "dlr DELIVRD"
+		states := []string{}
+		for name := range output {
+			if strings.HasPrefix(name, "dlr ") && name[4:] == strings.ToUpper(name[4:]) {
+				states = append(states, name)
+			}
+		}
+		sort.Strings(states)
+		for _, m := range states {
+			result += fmt.Sprintf(" %s:%d ", m, output[m])
+		}
+		// submit failures by command_status, e.g. "ao failure.ESME_RTHROTTLED"
+		failures := []string{}
+		for name := range output {
+			if strings.HasPrefix(name, "ao failure.") {
+				failures = append(failures, name)
+			}
+		}
+		sort.Strings(failures)
+		for _, m := range failures {
+			result += fmt.Sprintf(" %s:%d ", m, output[m])
+		}
+		for _, sample := range interval.Samples {
+			if sample.Name == "dlr_latency" {
+				result += fmt.Sprintf(" dlr latency(ms):%.0f ", sample.AggregateSample.Mean())
+			}
+		}
+
+		// binds running below their target rate after backing off
+		for _, b := range handler.BindRates() {
+			if b.Effective < b.Target {
+				result += fmt.Sprintf(" backoff %d/%d:%d/%d ", b.Group, b.Conn, b.Effective, b.Target)
+			}
+		}
+
+		// use of the recipient lists
+		for _, g := range handler.Status().Groups {
+			if r := g.Recipients; r != nil {
+				result += fmt.Sprintf(" recipients %d:%d/%d(%.1f%%) passes:%d ", g.Group, r.Position, r.Total, r.Percent, r.Passes)
+			}
+		}
+
+		// percentiles since start or the last reset
+		for _, l := range metrics.Latency() {
+			result += latencyLine("submit latency(ms) "+l.Group, l.Submit)
+			result += latencyLine("receipt latency(ms) "+l.Group, l.Receipt)
+		}
 
 		log.Info(result)
 	}
 }
+
+func latencyLine(name string, s hdr.Snapshot) string {
+	if s.Count == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" %s p50:%.1f p90:%.1f p99:%.1f p99.9:%.1f max:%.1f ", name, s.P50, s.P90, s.P99, s.P999, s.Max)
+}
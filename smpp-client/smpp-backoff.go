@@ -0,0 +1,102 @@
+package smppclient
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/skill215/go-smpp/smpp/pdu"
+	"github.com/skill215/smpp-app/config"
+)
+
+// submit_sm_resp statuses the bind backs off on
+const (
+	statusMsgQFull  pdu.Status = 0x14 // ESME_RMSGQFUL
+	statusThrottled pdu.Status = 0x58 // ESME_RTHROTTLED
+)
+
+// BindRate is the pacing of one sending bind.
+type BindRate struct {
+	// rate set by startLoop, /api/tps or a traffic profile
+	Target int `json:"target_tps"`
+	// rate in effect, below the target while backed off
+	Effective int   `json:"effective_tps"`
+	Backoffs  int64 `json:"backoff_events"`
+}
+
+// aimd lowers the rate of a bind multiplicatively on throttling responses
+// and raises it additively back to the target.
+type aimd struct {
+	mu     sync.Mutex
+	conf   config.BackoffConfig
+	target int
+	rate   float64
+	// last back-off or increase, each happens at most once per interval
+	changed time.Time
+	events  int64
+}
+
+// backoffTick is how often a sending connection checks whether its rate
+// may grow back, a fraction of the interval so steps are not skipped.
+func backoffTick(conf *config.SmppConfig) time.Duration {
+	if tick := conf.Client.Backoff.Interval / 4; tick > 0 {
+		return tick
+	}
+	return time.Second
+}
+
+func newAimd(conf config.BackoffConfig, tps int) *aimd {
+	return &aimd{conf: conf, target: tps, rate: float64(tps)}
+}
+
+// setTarget changes the rate to reach and returns the effective rate. A
+// back-off in progress is kept as long as it stays below the new target.
+func (a *aimd) setTarget(tps int) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	backedOff := a.rate < float64(a.target)
+	a.target = tps
+	if !backedOff || a.rate > float64(tps) {
+		a.rate = float64(tps)
+	}
+	return a.effective()
+}
+
+// throttled backs off and returns the new rate, unless back-off is
+// disabled or the last change was less than an interval ago: responses to
+// submit_sm already in flight do not cut the rate again.
+func (a *aimd) throttled(now time.Time) (int, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.conf.Enable || a.target == 0 || now.Sub(a.changed) < a.conf.Interval {
+		return 0, false
+	}
+	a.rate = math.Max(1, a.rate*a.conf.Decrease)
+	a.changed = now
+	a.events++
+	return a.effective(), true
+}
+
+// recover raises a backed off rate by one step and returns it, it reports
+// false when there is nothing to raise yet.
+func (a *aimd) recover(now time.Time) (int, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.rate >= float64(a.target) || now.Sub(a.changed) < a.conf.Interval {
+		return 0, false
+	}
+	step := math.Max(1, float64(a.target)*a.conf.Increase)
+	a.rate = math.Min(float64(a.target), a.rate+step)
+	a.changed = now
+	return a.effective(), true
+}
+
+func (a *aimd) effective() int {
+	return int(math.Round(a.rate))
+}
+
+func (a *aimd) state() BindRate {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return BindRate{Target: a.target, Effective: a.effective(), Backoffs: a.events}
+}
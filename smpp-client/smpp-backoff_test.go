@@ -0,0 +1,62 @@
+package smppclient
+
+import (
+	"testing"
+	"time"
+
+	"github.com/skill215/smpp-app/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func testBackoff() config.BackoffConfig {
+	return config.BackoffConfig{Enable: true, Decrease: 0.5, Increase: 0.1, Interval: time.Second}
+}
+
+func TestAimdBackoffAndRecover(t *testing.T) {
+	a := newAimd(testBackoff(), 100)
+	now := time.Now()
+
+	rate, ok := a.throttled(now)
+	assert.True(t, ok)
+	assert.Equal(t, 50, rate)
+	// responses of the same window do not cut again
+	_, ok = a.throttled(now.Add(100 * time.Millisecond))
+	assert.False(t, ok)
+	_, ok = a.recover(now.Add(500 * time.Millisecond))
+	assert.False(t, ok)
+
+	rate, ok = a.throttled(now.Add(time.Second))
+	assert.True(t, ok)
+	assert.Equal(t, 25, rate)
+
+	// back by 10% of the target per interval
+	rate, ok = a.recover(now.Add(2 * time.Second))
+	assert.True(t, ok)
+	assert.Equal(t, 35, rate)
+	for i := 3; i < 20; i++ {
+		a.recover(now.Add(time.Duration(i) * time.Second))
+	}
+	assert.Equal(t, 100, a.state().Effective)
+	_, ok = a.recover(now.Add(time.Minute))
+	assert.False(t, ok)
+	assert.Equal(t, BindRate{Target: 100, Effective: 100, Backoffs: 2}, a.state())
+}
+
+func TestAimdTarget(t *testing.T) {
+	a := newAimd(testBackoff(), 100)
+	a.throttled(time.Now())
+
+	// a higher target keeps the back-off, a lower one caps it
+	assert.Equal(t, 50, a.setTarget(200))
+	assert.Equal(t, 20, a.setTarget(20))
+	assert.Equal(t, 40, a.setTarget(40))
+}
+
+func TestAimdDisabled(t *testing.T) {
+	conf := testBackoff()
+	conf.Enable = false
+	a := newAimd(conf, 100)
+	_, ok := a.throttled(time.Now())
+	assert.False(t, ok)
+	assert.Equal(t, 100, a.state().Effective)
+}
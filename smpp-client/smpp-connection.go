@@ -0,0 +1,318 @@
+package smppclient
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/skill215/go-smpp/smpp"
+	"github.com/skill215/go-smpp/smpp/pdu"
+	"github.com/skill215/smpp-app/config"
+	"github.com/skill215/smpp-app/limiter"
+)
+
+// connection keeps one bind of a group up, binding again after the
+// session fails until its context is done.
+type connection struct {
+	index   int
+	conf    sessionConfig
+	log     *logrus.Entry
+	states  *connStates
+	metrics *connMetrics
+	// when to bind again after a failure
+	reconnect reconnectPolicy
+	// binds after the first one
+	reconnects int64
+	sent       rateMeter
+
+	mu   sync.Mutex
+	sess *session
+
+	// manual unbind, rebind and close for run, paused stops the submits
+	// of a bound connection
+	ctl    chan string
+	paused int32
+
+	// pacing of submit_sm, nil on receivers. paceMu keeps the limiter in
+	// step with the back-off changed from the response callbacks.
+	paceMu  sync.Mutex
+	limiter *limiter.Limiter
+	backoff *aimd
+}
+
+// newConnection sets up connection i of a group, handler gets the
+// deliver_sm and data_sm received on it.
+func newConnection(group, i int, conf *config.SmppConfig, states *connStates, metrics *Metrics, log *logrus.Logger, handler func(c *connection, p pdu.Body)) *connection {
+	bindID := pdu.BindTransmitterID
+	switch strings.ToLower(conf.Client.Type) {
+	case "receiver":
+		bindID = pdu.BindReceiverID
+	case "transceiver":
+		bindID = pdu.BindTransceiverID
+	}
+	addr := fmt.Sprintf("%s:%d", conf.Server.Addr, conf.Server.Port)
+	user, password := conf.Account(i)
+	version, _ := config.ParseInterfaceVersion(conf.Server.InterfaceVersion)
+	c := &connection{
+		index: i,
+		conf: sessionConfig{
+			addr:             addr,
+			bindID:           bindID,
+			systemID:         user,
+			password:         password,
+			systemType:       conf.Server.SystemType,
+			interfaceVersion: version,
+			addrTON:          conf.Server.AddrTon,
+			addrNPI:          conf.Server.AddrNpi,
+			addressRange:     conf.Server.AddressRange,
+			window:           conf.Client.Window,
+			respTimeout:      conf.Client.RespTimeout,
+		},
+		log: log.WithFields(logrus.Fields{
+			"addr": addr,
+			"user": user,
+			"type": conf.Client.Type,
+			"conn": i,
+		}),
+		states:    states,
+		metrics:   metrics.conn(group, conf, i),
+		reconnect: reconnectPolicy{conf: conf.Client.Reconnect},
+		ctl:       make(chan string, 1),
+	}
+	if conf.Server.TLS.Enable {
+		tls := conf.Server.TLS
+		c.conf.tls = &tls
+	}
+	if handler != nil {
+		c.conf.handler = func(p pdu.Body) {
+			c.metrics.deliverSM.Inc()
+			handler(c, p)
+		}
+	}
+	return c
+}
+
+// run binds and rebinds until ctx is done, then unbinds. It gives up on a
+// fatal bind failure, or after the failed binds in a row the reconnect
+// policy allows. A manual unbind or close holds the connection down, a
+// rebind binds again at once, even after giving up.
+func (c *connection) run(ctx context.Context) {
+	defer func() {
+		c.metrics.up.Set(0)
+		if c.metrics.tps != nil {
+			c.metrics.tps.Set(0)
+		}
+	}()
+	failures := 0
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			c.metrics.reconnects.Inc()
+			atomic.AddInt64(&c.reconnects, 1)
+		}
+		s, err := dialSession(ctx, c.conf)
+		if ctx.Err() != nil {
+			if s != nil {
+				s.Close()
+			}
+			return
+		}
+		if err != nil {
+			status := smpp.ConnectionFailed
+			if _, ok := err.(pdu.Status); ok {
+				status = smpp.BindFailed
+			}
+			class := bindFailure(err)
+			failures++
+			c.states.set(c.index, status.String(), err)
+			c.metrics.bindFailure(class)
+			c.log.WithFields(logrus.Fields{
+				"error":    err,
+				"status":   status.String(),
+				"class":    class,
+				"failures": failures,
+			}).Error("SMPP bind failed")
+			if netErr, ok := err.(*net.OpError); ok {
+				c.log.WithFields(logrus.Fields{
+					"network":     netErr.Net,
+					"address":     netErr.Addr,
+					"timeout":     netErr.Timeout(),
+					"error_phase": netErr.Op,
+				}).Error("Network operation error details")
+			}
+			if c.reconnect.fatal(class) || c.reconnect.exhausted(failures) {
+				c.states.set(c.index, statusGaveUp, err)
+				c.log.WithFields(logrus.Fields{
+					"class":    class,
+					"failures": failures,
+				}).Error("SMPP bind given up")
+				if !c.hold(ctx) {
+					return
+				}
+				failures = 0
+				continue
+			}
+		} else {
+			failures = 0
+			c.setSession(s)
+			c.states.set(c.index, smpp.Connected.String(), nil)
+			c.metrics.up.Set(1)
+			if version, cipher := s.tlsState(); version != "" {
+				c.log.WithFields(logrus.Fields{
+					"tls_version": version,
+					"tls_cipher":  cipher,
+				}).Info("SMPP bind successful")
+			} else {
+				c.log.Info("SMPP bind successful")
+			}
+			var action string
+			select {
+			case <-ctx.Done():
+				c.setSession(nil)
+				s.Close()
+				return
+			case <-s.Done():
+			case action = <-c.ctl:
+			}
+			c.setSession(nil)
+			c.metrics.up.Set(0)
+			if action != "" {
+				c.drop(s, action)
+				if action != ActionRebind && !c.hold(ctx) {
+					return
+				}
+				continue
+			}
+			c.states.set(c.index, smpp.Disconnected.String(), s.Err())
+			c.log.WithError(s.Err()).Warn("SMPP connection lost")
+		}
+		delay := c.reconnect.delay(failures, rand.Float64())
+		c.log.WithField("delay", delay).Debug("Waiting to rebind")
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		case action := <-c.ctl:
+			t.Stop()
+			if action != ActionRebind {
+				c.states.set(c.index, manualStatus(action), nil)
+				if !c.hold(ctx) {
+					return
+				}
+			}
+		}
+		c.log.Debug("Attempting to rebind...")
+	}
+}
+
+func (c *connection) setSession(s *session) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sess = s
+}
+
+// session returns the bound session, nil while not bound.
+func (c *connection) session() *session {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sess
+}
+
+// submit sends the parts of one message, each waiting for room in the
+// window. done is called for every part sent, an error is returned for
+// the first part that could not be.
+func (c *connection) submit(ctx context.Context, parts []pdu.Body, done func(resp pdu.Body, latency time.Duration, err error)) error {
+	s := c.session()
+	if s == nil {
+		return ErrSessionClosed
+	}
+	for _, p := range parts {
+		if err := s.Submit(ctx, p, done); err != nil {
+			return err
+		}
+		c.metrics.submits.Inc()
+		c.sent.add(time.Now())
+	}
+	return nil
+}
+
+// live fills in what st takes from the session and the counters.
+func (c *connection) live(st *ConnState) {
+	st.Reconnects = atomic.LoadInt64(&c.reconnects)
+	st.Paused = c.isPaused()
+	st.Tps = c.sent.rate(time.Now())
+	s := c.session()
+	if s == nil {
+		return
+	}
+	st.RemoteAddr = s.conn.RemoteAddr().String()
+	st.TLSVersion, st.Cipher = s.tlsState()
+	st.InFlight = s.inFlight()
+	if t := s.lastEnquireLink(); !t.IsZero() {
+		st.LastEnquireLink = &t
+	}
+}
+
+// pace sets up the submit_sm rate of a sending connection at tps.
+func (c *connection) pace(tps int, conf *config.SmppConfig) {
+	c.backoff = newAimd(conf.Client.Backoff, tps)
+	c.limiter = limiter.New(tps, time.Second, conf.Client.Burst)
+	c.metrics.tps.Set(float64(tps))
+}
+
+// setTps changes the target rate, a back-off in progress is kept.
+func (c *connection) setTps(tps int) {
+	c.paceMu.Lock()
+	defer c.paceMu.Unlock()
+	rate := c.backoff.setTarget(tps)
+	c.limiter.Set(rate, time.Second)
+	c.metrics.tps.Set(float64(rate))
+}
+
+// throttled backs off after a throttling response and reports whether
+// the rate was cut.
+func (c *connection) throttled(status pdu.Status) bool {
+	c.paceMu.Lock()
+	defer c.paceMu.Unlock()
+	rate, ok := c.backoff.throttled(time.Now())
+	if !ok {
+		return false
+	}
+	c.limiter.Set(rate, time.Second)
+	c.metrics.tps.Set(float64(rate))
+	c.metrics.backoffs.Inc()
+	c.log.WithFields(logrus.Fields{
+		"status":        status.Error(),
+		"effective_tps": rate,
+	}).Warn("SMPP bind backing off")
+	return true
+}
+
+// recover raises a backed off rate by one step when it is due.
+func (c *connection) recover() {
+	c.paceMu.Lock()
+	defer c.paceMu.Unlock()
+	rate, ok := c.backoff.recover(time.Now())
+	if !ok {
+		return
+	}
+	c.limiter.Set(rate, time.Second)
+	c.metrics.tps.Set(float64(rate))
+	c.log.WithField("effective_tps", rate).Debug("SMPP bind recovering from back-off")
+}
+
+// rate returns the pacing of a sending connection, nil on receivers.
+func (c *connection) rate() *BindRate {
+	if c.backoff == nil {
+		return nil
+	}
+	r := c.backoff.state()
+	return &r
+}
@@ -0,0 +1,142 @@
+package smppclient
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// manual actions on a connection through the REST API
+const (
+	// unbind and stay down until a rebind
+	ActionUnbind = "unbind"
+	// unbind if bound and bind again at once
+	ActionRebind = "rebind"
+	// close the TCP connection with a reset, without unbind, and stay
+	// down until a rebind
+	ActionClose = "close"
+	// keep the bind but stop submitting, until a resume
+	ActionPause  = "pause"
+	ActionResume = "resume"
+)
+
+// states of a connection held down by hand
+const (
+	statusUnbound = "Unbound"
+	statusClosed  = "Closed"
+)
+
+// manualStatus returns the state of a connection after action.
+func manualStatus(action string) string {
+	switch action {
+	case ActionUnbind:
+		return statusUnbound
+	case ActionClose:
+		return statusClosed
+	}
+	return "Binding"
+}
+
+// control hands a manual action to the connection, an unbind, rebind or
+// close is taken by run, replacing one it has not taken yet.
+func (c *connection) control(action string) {
+	switch action {
+	case ActionPause:
+		atomic.StoreInt32(&c.paused, 1)
+	case ActionResume:
+		atomic.StoreInt32(&c.paused, 0)
+	default:
+		select {
+		case <-c.ctl:
+		default:
+		}
+		select {
+		case c.ctl <- action:
+		default:
+		}
+	}
+	c.log.WithField("action", action).Info("SMPP connection action requested")
+}
+
+// isPaused reports whether the submits of the connection are paused.
+func (c *connection) isPaused() bool {
+	return atomic.LoadInt32(&c.paused) == 1
+}
+
+// drop takes down the bound session s for a manual action.
+func (c *connection) drop(s *session, action string) {
+	if action == ActionClose {
+		s.Reset()
+	} else {
+		s.Close()
+	}
+	c.states.set(c.index, manualStatus(action), nil)
+	c.log.WithField("action", action).Warn("SMPP connection dropped by hand")
+}
+
+// hold keeps the connection down until a rebind, it reports false if ctx
+// is done first.
+func (c *connection) hold(ctx context.Context) bool {
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case action := <-c.ctl:
+			if action == ActionRebind {
+				c.states.set(c.index, manualStatus(action), nil)
+				return true
+			}
+		}
+	}
+}
+
+// control applies action to connection conn of the group, to all of them
+// with conn -1.
+func (cs *connStates) control(conn int, action string) error {
+	cs.Lock()
+	defer cs.Unlock()
+	if len(cs.links) == 0 {
+		return fmt.Errorf("the connections are not started")
+	}
+	if conn >= len(cs.links) {
+		return fmt.Errorf("no connection %d", conn)
+	}
+	for i, c := range cs.links {
+		if conn == -1 || conn == i {
+			c.control(action)
+		}
+	}
+	return nil
+}
+
+// Control applies a manual action to connection conn of the group
+// addressed by name or index, or with conn -1 to every connection of the
+// group. Unbind, rebind and close go through the reconnect loop of the
+// connection, which keeps an unbound or closed connection down until it
+// is rebound.
+func (sh *SmppHandler) Control(group string, conn int, action string) error {
+	sh.Lock()
+	defer sh.Unlock()
+	i, err := sh.groupIndex(group)
+	if err != nil {
+		return err
+	}
+	action = strings.ToLower(action)
+	switch action {
+	case ActionUnbind, ActionRebind, ActionClose:
+	case ActionPause, ActionResume:
+		if !sh.conf[i].IsTransmitter() {
+			return fmt.Errorf("group %s is a receiver", group)
+		}
+	default:
+		return fmt.Errorf("action must be unbind, rebind, close, pause or resume, got %q", action)
+	}
+	if conn < -1 {
+		return fmt.Errorf("group %s has no connection %d", group, conn)
+	}
+	if err := sh.clients[i].Control(conn, action); err != nil {
+		return fmt.Errorf("group %s: %w", group, err)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package smppclient
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/skill215/go-smpp/smpp"
+	"github.com/skill215/smpp-app/config"
+	"github.com/skill215/smpp-app/prom"
+	"github.com/stretchr/testify/assert"
+)
+
+// waitStatus waits for connection 0 of cs to reach status.
+func waitStatus(t *testing.T, cs *connStates, status string) {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if cs.list()[0].Status == status {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("status %q not reached, got %q", status, cs.list()[0].Status)
+}
+
+func TestConnectionControl(t *testing.T) {
+	host, port, _ := net.SplitHostPort(startSmsc(t, 0))
+	conf := config.SmppConfig{}
+	conf.Server.Addr = host
+	p, _ := strconv.Atoi(port)
+	conf.Server.Port = uint16(p)
+	conf.Server.User = "user"
+	conf.Client.Type = "transmitter"
+	conf.Client.RespTimeout = time.Second
+	conf.Client.Reconnect = config.ReconnectConfig{InitialDelay: time.Minute, MaxDelay: time.Minute, Multiplier: 1}
+
+	cs := &connStates{}
+	c := newConnection(0, 0, &conf, cs, NewMetrics(prom.NewRegistry()), logrus.New(), nil)
+	cs.reset([]*connection{c})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.run(ctx)
+		close(done)
+	}()
+	waitStatus(t, cs, smpp.Connected.String())
+
+	// held down instead of waiting for the reconnect delay
+	assert.Nil(t, cs.control(0, ActionUnbind))
+	waitStatus(t, cs, statusUnbound)
+	assert.Nil(t, c.session())
+	assert.Nil(t, cs.control(-1, ActionRebind))
+	waitStatus(t, cs, smpp.Connected.String())
+
+	assert.Nil(t, cs.control(0, ActionClose))
+	waitStatus(t, cs, statusClosed)
+	assert.Nil(t, cs.control(0, ActionRebind))
+	waitStatus(t, cs, smpp.Connected.String())
+	assert.Equal(t, int64(2), cs.list()[0].Reconnects)
+
+	assert.Nil(t, cs.control(0, ActionPause))
+	assert.True(t, cs.list()[0].Paused)
+	assert.Nil(t, cs.control(0, ActionResume))
+	assert.False(t, cs.list()[0].Paused)
+	assert.NotNil(t, cs.control(1, ActionUnbind))
+
+	cancel()
+	<-done
+}
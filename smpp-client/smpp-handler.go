@@ -2,11 +2,21 @@ package smppclient
 
 import (
 	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	gometrics "github.com/armon/go-metrics"
 	"github.com/sirupsen/logrus"
-	"github.com/skill215/smpp-app/broker"
+	"github.com/skill215/go-smpp/smpp"
+	"github.com/skill215/go-smpp/smpp/pdu"
+	"github.com/skill215/go-smpp/smpp/pdu/pdufield"
 	"github.com/skill215/smpp-app/config"
+	"github.com/skill215/smpp-app/dlr"
+	msggenerator "github.com/skill215/smpp-app/msg-generator"
 )
 
 var (
@@ -15,27 +25,116 @@ var (
 
 type SmppClient interface {
 	Init()
-	Start(int)
+	// Start binds the connections and launches the submit workers,
+	// connection i sending at rates[i].
+	Start(rates []int)
+	// SetRates sets the rate of the started connections, rates[i] for
+	// connection i.
+	SetRates(rates []int)
+	// Stop cancels the workers and unbinds, Start may be called again.
 	Stop()
+	// Update applies the message settings of the group in place.
+	Update(config.SmppConfig)
+	// State returns the bind state of every connection of the group.
+	State() []ConnState
+	// Control applies a manual action to connection conn, to all of
+	// them with -1.
+	Control(conn int, action string) error
+}
+
+// ConnState is the bind state of one connection.
+type ConnState struct {
+	Index  int       `json:"index"`
+	Status string    `json:"status"`
+	Error  string    `json:"error,omitempty"`
+	Since  time.Time `json:"since"`
+	// pacing of a sending connection
+	Rate *BindRate `json:"rate,omitempty"`
+	// peer of the bound session
+	RemoteAddr string `json:"remote_addr,omitempty"`
+	// negotiated on SMPP over TLS
+	TLSVersion string     `json:"tls_version,omitempty"`
+	Cipher     string     `json:"tls_cipher,omitempty"`
+	BoundAt    *time.Time `json:"bound_at,omitempty"`
+	// binds after the first one since the traffic was started
+	Reconnects int64 `json:"reconnects"`
+	// the last error of a bind or a session, kept once bound again
+	LastError string `json:"last_error,omitempty"`
+	// submit_sm sent in the last full second
+	Tps int64 `json:"tps"`
+	// requests of the session waiting for their response
+	InFlight        int        `json:"in_flight"`
+	LastEnquireLink *time.Time `json:"last_enquire_link,omitempty"`
+	// submits stopped by hand while the bind is kept
+	Paused bool `json:"paused,omitempty"`
+}
+
+// GroupState is the state of one connection group of the config.
+type GroupState struct {
+	Group int         `json:"group"`
+	Type  string      `json:"bind_type"`
+	Addr  string      `json:"addr"`
+	User  string      `json:"user"`
+	Conns []ConnState `json:"conns"`
+	// use of the recipient list of a group sending to a csv file
+	Recipients *msggenerator.RecipientProgress `json:"recipients,omitempty"`
+}
+
+// recipientLister is a client that may send to a recipient list.
+type recipientLister interface {
+	Recipients() *msggenerator.RecipientProgress
+}
+
+// Status is the state of the handler returned by the REST API.
+type Status struct {
+	Running bool         `json:"running"`
+	Tps     int          `json:"tps"`
+	Groups  []GroupState `json:"groups"`
 }
 
 type SmppHandler struct {
+	sync.Mutex
 	log     *logrus.Logger
 	inm     *gometrics.InmemSink
-	broker  *broker.Broker
+	tracker *dlr.Tracker
+	metrics *Metrics
+	conf    []config.SmppConfig
 	clients []SmppClient
+	// whether the groups were bound by Run or Start since the last Stop
+	bound bool
+	// whether Start was called since the last Stop, and with which tps
+	running bool
+	tps     int
+	// per-connection tps of every group, set on the connections
+	rates [][]int
+	// traffic profiles running by group index
+	profiles map[int]*groupProfile
+}
+
+// GroupRate is the effective rate of a group returned by the REST API.
+type GroupRate struct {
+	Group   int    `json:"group"`
+	Name    string `json:"name,omitempty"`
+	Type    string `json:"bind_type"`
+	Tps     int    `json:"tps"`
+	ConnTps []int  `json:"conn_tps"`
 }
 
-func ProvideService(ctx context.Context, log *logrus.Logger, conf []config.SmppConfig, broker *broker.Broker, inm *gometrics.InmemSink) *SmppHandler {
+func ProvideService(ctx context.Context, log *logrus.Logger, conf []config.SmppConfig, inm *gometrics.InmemSink, metrics *Metrics) *SmppHandler {
 	handler := SmppHandler{
-		log:     log,
-		broker:  broker,
-		inm:     inm,
-		clients: []SmppClient{},
+		log:      log,
+		inm:      inm,
+		metrics:  metrics,
+		tracker:  dlr.NewTracker(log, inm),
+		conf:     conf,
+		clients:  []SmppClient{},
+		profiles: map[int]*groupProfile{},
 	}
+	go handler.tracker.Run(ctx, time.Second)
 
-	for _, c := range conf {
-		handler.clients = append(handler.clients, createClient(c, log, handler.inm, broker))
+	for i, c := range conf {
+		handler.clients = append(handler.clients, createClient(i, c, log, handler.inm, handler.tracker, metrics))
+		handler.rates = append(handler.rates, uniformRates(c, 0))
 	}
 
 	log.Infof("inital %d clinets\n", len(handler.clients))
@@ -48,27 +147,399 @@ func (sh *SmppHandler) Init(ctx context.Context) {
 	}
 }
 
+// Run binds every group, the sending groups at tps per connection. It does
+// not start the traffic: no traffic profile starts and the status reports
+// it stopped until Start. Groups already bound are left as they are.
 func (sh *SmppHandler) Run(ctx context.Context, tps int) {
-	for _, client := range sh.clients {
-		client.Start(tps)
+	sh.Lock()
+	defer sh.Unlock()
+	sh.bind(tps)
+}
+
+// bind starts the clients at tps per connection unless they are bound, sh
+// must be locked.
+func (sh *SmppHandler) bind(tps int) {
+	if sh.bound {
+		return
+	}
+	sh.bound = true
+	for i, client := range sh.clients {
+		sh.rates[i] = uniformRates(sh.conf[i], tps)
+		client.Start(sh.rates[i])
+	}
+}
+
+// Start starts the traffic at tps per connection, binding the groups first
+// if needed, and the configured traffic profiles. Called again while the
+// traffic runs it sets the rate, groups running a traffic profile keep
+// their scheduled rate.
+func (sh *SmppHandler) Start(ctx context.Context, tps int) {
+	sh.Lock()
+	defer sh.Unlock()
+	sh.bind(tps)
+	sh.running = true
+	sh.tps = tps
+	for i, client := range sh.clients {
+		if p, ok := sh.profiles[i]; ok {
+			// before its first tick the profile sets the rate itself
+			if rate := p.sched.Rate(); rate >= 0 {
+				sh.setGroupTps(i, -1, rate)
+			}
+			continue
+		}
+		sh.rates[i] = uniformRates(sh.conf[i], tps)
+		client.SetRates(sh.rates[i])
+	}
+	sh.startConfigProfiles()
+}
+
+// SetGroupTps sets the rate of the group addressed by name or index.
+// With conn -1 tps is split across the connections of the group, otherwise
+// it is the rate of connection conn alone.
+func (sh *SmppHandler) SetGroupTps(group string, conn int, tps int) (GroupRate, error) {
+	sh.Lock()
+	defer sh.Unlock()
+	i, err := sh.groupIndex(group)
+	if err != nil {
+		return GroupRate{}, err
+	}
+	if !sh.conf[i].IsTransmitter() {
+		return GroupRate{}, fmt.Errorf("group %s is a receiver", group)
+	}
+	count := int(sh.conf[i].Client.Count)
+	if count == 0 || conn < -1 || conn >= count {
+		return GroupRate{}, fmt.Errorf("group %s has no connection %d", group, conn)
+	}
+	// a rate set by hand overrides the traffic profile of the group
+	if _, ok := sh.profiles[i]; ok {
+		sh.stopProfile(i)
+		sh.log.WithField("group", group).Info("Traffic profile stopped by manual tps")
 	}
+	sh.setGroupTps(i, conn, tps)
+	sh.log.WithFields(logrus.Fields{
+		"group": group,
+		"conn":  conn,
+		"tps":   tps,
+	}).Info("Group tps set")
+	return sh.groupRate(i), nil
 }
 
+// setGroupTps records the rate of group i and sets it on its connections,
+// sh must be locked.
+func (sh *SmppHandler) setGroupTps(i, conn, tps int) {
+	for c := range sh.rates[i] {
+		if r, ok := connTps(conn, tps, c, len(sh.rates[i])); ok {
+			sh.rates[i][c] = r
+		}
+	}
+	sh.clients[i].SetRates(sh.rates[i])
+}
+
+// Rates returns the effective rate of every group.
+func (sh *SmppHandler) Rates() []GroupRate {
+	sh.Lock()
+	defer sh.Unlock()
+	rates := []GroupRate{}
+	for i := range sh.conf {
+		rates = append(rates, sh.groupRate(i))
+	}
+	return rates
+}
+
+func (sh *SmppHandler) groupRate(i int) GroupRate {
+	r := GroupRate{
+		Group:   i,
+		Name:    sh.conf[i].Name,
+		Type:    sh.conf[i].Client.Type,
+		ConnTps: append([]int{}, sh.rates[i]...),
+	}
+	for _, tps := range sh.rates[i] {
+		r.Tps += tps
+	}
+	return r
+}
+
+// groupIndex resolves a group by its configured name, or by its index.
+func (sh *SmppHandler) groupIndex(group string) (int, error) {
+	for i := range sh.conf {
+		if sh.conf[i].Name != "" && sh.conf[i].Name == group {
+			return i, nil
+		}
+	}
+	if i, err := strconv.Atoi(group); err == nil && i >= 0 && i < len(sh.conf) {
+		return i, nil
+	}
+	return 0, fmt.Errorf("unknown group %q", group)
+}
+
+// Stop stops all clients concurrently and returns once every connection
+// has been unbound.
 func (sh *SmppHandler) Stop(ctx context.Context) {
-	for _, client := range sh.clients {
-		client.Stop()
+	sh.Lock()
+	defer sh.Unlock()
+	sh.bound = false
+	sh.running = false
+	sh.stopProfiles()
+	stopAll(sh.clients)
+	for i := range sh.rates {
+		sh.rates[i] = uniformRates(sh.conf[i], 0)
 	}
 }
 
-func createClient(conf config.SmppConfig, log *logrus.Logger, inm *gometrics.InmemSink, broker *broker.Broker) SmppClient {
+// Apply switches to a new list of connection groups. A group whose server,
+// bind type and connection count are unchanged gets its message settings
+// updated in place, every other group is rebuilt and, if the groups are
+// bound, bound again. It returns the number of groups updated and rebuilt.
+func (sh *SmppHandler) Apply(conf []config.SmppConfig) (updated, rebuilt int) {
+	sh.Lock()
+	defer sh.Unlock()
+
+	clients := make([]SmppClient, len(conf))
+	rates := make([][]int, len(conf))
+	stale, fresh := []SmppClient{}, []int{}
+	for i := range conf {
+		if i < len(sh.clients) && sh.conf[i].SameConnection(&conf[i]) {
+			sh.clients[i].Update(conf[i])
+			clients[i] = sh.clients[i]
+			rates[i] = sh.rates[i]
+			if p, ok := sh.profiles[i]; ok && p.fromConfig &&
+				!reflect.DeepEqual(sh.conf[i].Message.TrafficProfile, conf[i].Message.TrafficProfile) {
+				sh.stopProfile(i)
+			}
+			updated++
+			continue
+		}
+		if i < len(sh.clients) {
+			stale = append(stale, sh.clients[i])
+			sh.stopProfile(i)
+		}
+		// a rebuilt group starts at the per-connection rate of startLoop
+		clients[i] = createClient(i, conf[i], sh.log, sh.inm, sh.tracker, sh.metrics)
+		rates[i] = uniformRates(conf[i], 0)
+		if sh.running {
+			rates[i] = uniformRates(conf[i], sh.tps)
+		}
+		fresh = append(fresh, i)
+		rebuilt++
+	}
+	removed := 0
+	if len(sh.clients) > len(conf) {
+		removed = len(sh.clients) - len(conf)
+		stale = append(stale, sh.clients[len(conf):]...)
+		for i := len(conf); i < len(sh.clients); i++ {
+			sh.stopProfile(i)
+		}
+	}
+
+	// unbind before binding again, the server may limit binds per system_id
+	stopAll(stale)
+	for _, i := range fresh {
+		clients[i].Init()
+		if sh.bound {
+			clients[i].Start(rates[i])
+		}
+	}
+	sh.conf = conf
+	sh.clients = clients
+	sh.rates = rates
+	if sh.running {
+		sh.startConfigProfiles()
+	}
+	sh.log.WithFields(logrus.Fields{
+		"updated": updated,
+		"rebuilt": rebuilt,
+		"removed": removed,
+	}).Info("SMPP config applied")
+	return updated, rebuilt
+}
+
+// Status returns whether traffic is running and the bind state of every
+// connection.
+func (sh *SmppHandler) Status() Status {
+	sh.Lock()
+	defer sh.Unlock()
+	status := Status{Running: sh.running, Tps: sh.tps, Groups: []GroupState{}}
+	for i, client := range sh.clients {
+		g := GroupState{
+			Group: i,
+			Type:  sh.conf[i].Client.Type,
+			Addr:  fmt.Sprintf("%s:%d", sh.conf[i].Server.Addr, sh.conf[i].Server.Port),
+			User:  sh.conf[i].Server.User,
+			Conns: client.State(),
+		}
+		if rl, ok := client.(recipientLister); ok {
+			g.Recipients = rl.Recipients()
+		}
+		status.Groups = append(status.Groups, g)
+	}
+	return status
+}
+
+// ConnRate is the pacing of one sending connection of a group.
+type ConnRate struct {
+	Group int    `json:"group"`
+	Name  string `json:"name,omitempty"`
+	Conn  int    `json:"conn"`
+	BindRate
+}
+
+// BindRates returns the pacing of every bound or binding sending
+// connection, with its back-off.
+func (sh *SmppHandler) BindRates() []ConnRate {
+	sh.Lock()
+	defer sh.Unlock()
+	rates := []ConnRate{}
+	for i, client := range sh.clients {
+		for _, c := range client.State() {
+			if c.Rate == nil {
+				continue
+			}
+			rates = append(rates, ConnRate{Group: i, Name: sh.conf[i].Name, Conn: c.Index, BindRate: *c.Rate})
+		}
+	}
+	return rates
+}
+
+// ReceiptStats returns the delivery receipt correlation totals.
+func (sh *SmppHandler) ReceiptStats() dlr.Stats {
+	return sh.tracker.Stats()
+}
+
+func createClient(group int, conf config.SmppConfig, log *logrus.Logger, inm *gometrics.InmemSink, tracker *dlr.Tracker, metrics *Metrics) SmppClient {
 	ctx := context.Background()
 	log.Infof("create client with conf %+v", conf)
-	switch conf.Client.Type {
+	switch strings.ToLower(conf.Client.Type) {
 	case "transceiver":
-		return ProvideSmppTransceiver(ctx, conf, inm, broker, log)
+		return ProvideSmppTransceiver(ctx, group, conf, inm, tracker, metrics, log)
 	case "receiver":
-		return ProvideSmppReceiver(ctx, conf, inm, broker, log)
+		return ProvideSmppReceiver(ctx, group, conf, inm, tracker, metrics, log)
 	default:
-		return ProvideSmppTransmitter(ctx, conf, inm, broker, log)
+		return ProvideSmppTransmitter(ctx, group, conf, inm, tracker, metrics, log)
+	}
+}
+
+// connTps returns the rate of connection i of a group of count when tps
+// is set on connection conn alone, or with conn -1 split across the group.
+// It reports false if connection i keeps its rate.
+func connTps(conn, tps, i, count int) (int, bool) {
+	if conn >= 0 {
+		return tps, conn == i
+	}
+	// split the total, the first connections take the remainder
+	rate := tps / count
+	if i < tps%count {
+		rate++
+	}
+	return rate, true
+}
+
+// uniformRates returns tps for every connection of a sending group.
+func uniformRates(conf config.SmppConfig, tps int) []int {
+	rates := make([]int, conf.Client.Count)
+	if conf.IsTransmitter() {
+		for i := range rates {
+			rates[i] = tps
+		}
+	}
+	return rates
+}
+
+// connStates tracks the bind state of the connections of a group, it is
+// written by the reconnect goroutines and read by the REST API.
+type connStates struct {
+	sync.Mutex
+	conns []ConnState
+	links []*connection
+}
+
+// reset sets up connections that have not bound yet.
+func (cs *connStates) reset(links []*connection) {
+	cs.Lock()
+	defer cs.Unlock()
+	cs.links = links
+	cs.conns = make([]ConnState, len(links))
+	for i := range cs.conns {
+		cs.conns[i] = ConnState{Index: i, Status: "Binding", Since: time.Now()}
+	}
+}
+
+func (cs *connStates) set(i int, status string, err error) {
+	cs.Lock()
+	defer cs.Unlock()
+	if i >= len(cs.conns) {
+		return
+	}
+	prev := cs.conns[i]
+	c := ConnState{Index: i, Status: status, Since: prev.Since, BoundAt: prev.BoundAt, LastError: prev.LastError}
+	if err != nil {
+		c.Error = err.Error()
+		c.LastError = c.Error
+	}
+	if c.Status != prev.Status {
+		c.Since = time.Now()
+		c.BoundAt = nil
+		if status == smpp.Connected.String() {
+			c.BoundAt = &c.Since
+		}
+	}
+	cs.conns[i] = c
+}
+
+func (cs *connStates) list() []ConnState {
+	cs.Lock()
+	defer cs.Unlock()
+	conns := append([]ConnState{}, cs.conns...)
+	for i := range conns {
+		conns[i].Rate = cs.links[i].rate()
+		cs.links[i].live(&conns[i])
+	}
+	return conns
+}
+
+// stopAll stops the clients concurrently.
+func stopAll(clients []SmppClient) {
+	var wg sync.WaitGroup
+	for _, client := range clients {
+		wg.Add(1)
+		go func(client SmppClient) {
+			defer wg.Done()
+			client.Stop()
+		}(client)
+	}
+	wg.Wait()
+}
+
+// sleepCtx sleeps for d and reports false if ctx was cancelled meanwhile.
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// respMessageID returns the message_id of a submit_sm_resp, or empty.
+func respMessageID(resp pdu.Body) string {
+	if f := resp.Fields()[pdufield.MessageID]; f != nil {
+		return f.String()
+	}
+	return ""
+}
+
+// handleReceipt passes a deliver_sm receipt received on conn to the
+// tracker.
+func handleReceipt(log *logrus.Logger, tracker *dlr.Tracker, conn *connection, p pdu.Body, grace time.Duration) {
+	if !dlr.IsReceipt(p) {
+		return
+	}
+	r, err := dlr.Parse(p)
+	if err != nil {
+		log.WithError(err).Debug("Failed to parse delivery receipt")
+		return
 	}
+	conn.metrics.receipt(r.State())
+	tracker.Receipt(r, grace)
 }
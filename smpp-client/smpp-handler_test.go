@@ -0,0 +1,217 @@
+package smppclient
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+
+	gometrics "github.com/armon/go-metrics"
+	"github.com/sirupsen/logrus"
+	"github.com/skill215/smpp-app/config"
+	"github.com/skill215/smpp-app/profile"
+	"github.com/skill215/smpp-app/prom"
+	"github.com/skill215/smpp-app/smsc"
+	"github.com/stretchr/testify/assert"
+	yaml "gopkg.in/yaml.v3"
+)
+
+func TestConnTpsSplit(t *testing.T) {
+	total := 0
+	for conn := 0; conn < 4; conn++ {
+		tps, ok := connTps(-1, 502, conn, 4)
+		assert.True(t, ok)
+		total += tps
+	}
+	assert.Equal(t, 502, total)
+
+	tps, _ := connTps(-1, 502, 0, 4)
+	assert.Equal(t, 126, tps)
+	tps, _ = connTps(-1, 502, 3, 4)
+	assert.Equal(t, 125, tps)
+}
+
+func TestConnTpsSingleConn(t *testing.T) {
+	tps, ok := connTps(2, 50, 2, 4)
+	assert.True(t, ok)
+	assert.Equal(t, 50, tps)
+	_, ok = connTps(2, 50, 1, 4)
+	assert.False(t, ok)
+}
+
+// testHandler returns a handler with one transmitter group of conns
+// connections to the SMSC at addr, message settings are added to its
+// message section.
+func testHandler(t *testing.T, addr string, conns int, message string) (*SmppHandler, *gometrics.InmemSink) {
+	host, port, _ := net.SplitHostPort(addr)
+	conf := &config.AppConfig{}
+	err := yaml.Unmarshal([]byte(fmt.Sprintf(`
+service:
+  smpp:
+  - server:
+      addr: %s
+      port: %s
+      user: user
+    client:
+      bind-type: transmitter
+      conn-num: %d
+    message:
+      send:
+        src:
+          oaddr: 1234
+        dst:
+          daddr:
+            prefix: 789
+        content: lifecycle test
+%s`, host, port, conns, message)), conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	inm := gometrics.NewInmemSink(time.Second, time.Minute)
+	sh := ProvideService(ctx, logrus.New(), conf.App.SmppConn, inm, NewMetrics(prom.NewRegistry()))
+	sh.Init(ctx)
+	return sh, inm
+}
+
+// eventually waits up to 2s for cond.
+func eventually(t *testing.T, cond func() bool, msg string) {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal(msg)
+}
+
+// submits returns the submit_sm answered since the handler was created.
+func submits(inm *gometrics.InmemSink) uint64 {
+	return counter(inm, "ao")
+}
+
+// counter returns the sum of the counter name since the handler was
+// created, the sink turns the spaces of a name into "_".
+func counter(inm *gometrics.InmemSink, name string) uint64 {
+	var n float64
+	for _, interval := range inm.Data() {
+		interval.RLock()
+		if c, ok := interval.Counters[name]; ok {
+			n += c.Sum
+		}
+		interval.RUnlock()
+	}
+	return uint64(n)
+}
+
+func TestHandlerRestart(t *testing.T) {
+	srv := smsc.New(config.SmscConfig{}, logrus.New())
+	if err := srv.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve()
+	defer srv.Close()
+	sh, inm := testHandler(t, srv.Addr(), 2, "")
+	goroutines := runtime.NumGoroutine()
+
+	for round := 0; round < 2; round++ {
+		sh.Start(context.Background(), 50)
+		sent := submits(inm)
+		eventually(t, func() bool { return submits(inm) >= sent+10 }, "no traffic")
+
+		sh.Stop(context.Background())
+		// the binds are closed at the SMSC and every goroutine is gone
+		eventually(t, func() bool { return srv.Sessions() == 0 }, "binds left open")
+		eventually(t, func() bool { return runtime.NumGoroutine() <= goroutines }, "goroutines leaked")
+		sent = submits(inm)
+		time.Sleep(100 * time.Millisecond)
+		assert.Equal(t, sent, submits(inm))
+	}
+}
+
+func TestHandlerStopDrains(t *testing.T) {
+	srv := startSmscServer(t, 100*time.Millisecond)
+	sh, inm := testHandler(t, srv.Addr(), 2, "")
+
+	sh.Start(context.Background(), 50)
+	eventually(t, func() bool { return submits(inm) >= 5 }, "no traffic")
+	sh.Stop(context.Background())
+	// the submits in flight got their response before the unbind
+	assert.Equal(t, uint64(0), counter(inm, "ao_error"))
+	assert.Equal(t, uint64(0), counter(inm, "ao_timeout"))
+	assert.Equal(t, counter(inm, "ao_segment"), submits(inm))
+}
+
+func TestHandlerRates(t *testing.T) {
+	srv := smsc.New(config.SmscConfig{}, logrus.New())
+	if err := srv.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve()
+	defer srv.Close()
+	sh, _ := testHandler(t, srv.Addr(), 3, "")
+	defer sh.Stop(context.Background())
+
+	targets := func() []int {
+		rates := []int{}
+		for _, c := range sh.Status().Groups[0].Conns {
+			rates = append(rates, c.Rate.Target)
+		}
+		return rates
+	}
+	// the connections start at the rate of the group
+	sh.Start(context.Background(), 4)
+	assert.Equal(t, []int{4, 4, 4}, targets())
+	// and every change reaches every connection at once
+	for tps := 10; tps < 200; tps++ {
+		_, err := sh.SetGroupTps("0", -1, tps)
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, []int{67, 66, 66}, targets())
+	sh.Start(context.Background(), 7)
+	assert.Equal(t, []int{7, 7, 7}, targets())
+
+	// a profile that has not ticked yet leaves the rate to its first tick
+	sh.Lock()
+	sh.profiles[0] = &groupProfile{sched: profile.NewScheduler(config.TrafficProfile{}, func(int) {})}
+	sh.Unlock()
+	sh.Start(context.Background(), 9)
+	assert.Equal(t, []int{7, 7, 7}, targets())
+}
+
+func TestHandlerBootSendsNothing(t *testing.T) {
+	srv := smsc.New(config.SmscConfig{}, logrus.New())
+	if err := srv.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve()
+	defer srv.Close()
+	sh, inm := testHandler(t, srv.Addr(), 2, `
+      traffic-profile:
+        tick: 100ms
+        phases:
+        - {type: hold, duration: 1m, tps: 100}
+`)
+	defer sh.Stop(context.Background())
+
+	// bound at 0 tps at boot, the profile waits for the traffic
+	sh.Run(context.Background(), 0)
+	eventually(t, func() bool {
+		conns, _ := sh.Connections("")
+		return conns.Bound == 2
+	}, "connections not bound")
+	time.Sleep(300 * time.Millisecond)
+	assert.Equal(t, uint64(0), submits(inm))
+	assert.False(t, sh.Status().Running)
+	assert.Empty(t, sh.Profiles())
+	assert.Equal(t, 0, sh.Rates()[0].Tps)
+
+	sh.Start(context.Background(), 0)
+	assert.True(t, sh.Status().Running)
+	assert.Len(t, sh.Profiles(), 1)
+	eventually(t, func() bool { return submits(inm) > 0 }, "the profile sends nothing")
+}
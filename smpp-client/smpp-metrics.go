@@ -0,0 +1,262 @@
+package smppclient
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skill215/go-smpp/smpp/pdu"
+	"github.com/skill215/smpp-app/config"
+	"github.com/skill215/smpp-app/hdr"
+	"github.com/skill215/smpp-app/prom"
+)
+
+// connLabels label every series of a connection.
+var connLabels = []string{"group", "account", "bind_type", "conn"}
+
+// Metrics are the Prometheus families of the SMPP connections.
+type Metrics struct {
+	messages   *prom.CounterVec
+	submits    *prom.CounterVec
+	failures   *prom.CounterVec
+	timeouts   *prom.CounterVec
+	errors     *prom.CounterVec
+	deliverSM  *prom.CounterVec
+	receipts   *prom.CounterVec
+	up         *prom.GaugeVec
+	reconnects *prom.CounterVec
+	bindFails  *prom.CounterVec
+	latency    *prom.HistogramVec
+	tps        *prom.GaugeVec
+	backoffs   *prom.CounterVec
+
+	// latency percentiles and failures per group since start, the
+	// Prometheus buckets are too coarse for the percentiles
+	mu     sync.Mutex
+	groups map[string]*groupStats
+}
+
+// groupStats are shared by the connections of a group.
+type groupStats struct {
+	submit  *hdr.Histogram
+	receipt *hdr.Histogram
+
+	mu       sync.Mutex
+	failures map[pdu.Status]uint64
+	errors   uint64
+}
+
+// GroupLatency is the latency summary of a group, submit is submit_sm to
+// submit_sm_resp and receipt is submit_sm to its delivery receipt.
+type GroupLatency struct {
+	Group   string       `json:"group"`
+	Submit  hdr.Snapshot `json:"submit"`
+	Receipt hdr.Snapshot `json:"receipt"`
+}
+
+// StatusCount is the number of submit_sm_resp with one command_status.
+type StatusCount struct {
+	Status      string `json:"status"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Count       uint64 `json:"count"`
+}
+
+// GroupFailures are the submit failures of a group by command_status,
+// sorted by count, and the submit_sm lost on the transport.
+type GroupFailures struct {
+	Group           string        `json:"group"`
+	Failures        []StatusCount `json:"failures"`
+	TransportErrors uint64        `json:"transport_errors"`
+}
+
+// NewMetrics registers the connection families in reg.
+func NewMetrics(reg *prom.Registry) *Metrics {
+	return &Metrics{
+		messages:   reg.Counter("smpp_messages_total", "Messages sent, once for all submit_sm of a concatenated one.", connLabels...),
+		submits:    reg.Counter("smpp_submit_sm_total", "submit_sm sent, one per segment.", connLabels...),
+		failures:   reg.Counter("smpp_submit_sm_failures_total", "submit_sm_resp with a non-zero command_status.", append(connLabels, "command_status", "status_name")...),
+		timeouts:   reg.Counter("smpp_submit_sm_timeouts_total", "submit_sm without a response within resp-timeout.", connLabels...),
+		errors:     reg.Counter("smpp_submit_sm_errors_total", "submit_sm not sent or not answered because the connection failed.", connLabels...),
+		deliverSM:  reg.Counter("smpp_deliver_sm_total", "deliver_sm received, receipts included.", connLabels...),
+		receipts:   reg.Counter("smpp_receipts_total", "Delivery receipts received by final state.", append(connLabels, "state")...),
+		up:         reg.Gauge("smpp_bind_up", "1 while the connection is bound.", connLabels...),
+		reconnects: reg.Counter("smpp_reconnects_total", "Bind attempts after a failed bind or a lost connection.", connLabels...),
+		bindFails:  reg.Counter("smpp_bind_failures_total", "Failed binds by class: network, auth or rejected.", append(connLabels, "class")...),
+		latency:    reg.Histogram("smpp_submit_sm_resp_latency_seconds", "Time from submit_sm to its submit_sm_resp.", prom.DefBuckets, connLabels...),
+		tps:        reg.Gauge("smpp_bind_tps", "Effective submit_sm rate of the connection, below the target while backed off.", connLabels...),
+		backoffs:   reg.Counter("smpp_backoff_total", "Rate cuts after ESME_RTHROTTLED or ESME_RMSGQFUL.", connLabels...),
+		groups:     map[string]*groupStats{},
+	}
+}
+
+func (m *Metrics) group(name string) *groupStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	g, ok := m.groups[name]
+	if !ok {
+		g = &groupStats{submit: hdr.New(), receipt: hdr.New(), failures: map[pdu.Status]uint64{}}
+		m.groups[name] = g
+	}
+	return g
+}
+
+// Latency returns the latency summary of every group that sent, sorted by
+// group.
+func (m *Metrics) Latency() []GroupLatency {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := make([]GroupLatency, 0, len(m.groups))
+	for name, g := range m.groups {
+		list = append(list, GroupLatency{
+			Group:   name,
+			Submit:  g.submit.Snapshot(),
+			Receipt: g.receipt.Snapshot(),
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Group < list[j].Group })
+	return list
+}
+
+// ResetLatency drops the latencies recorded so far.
+func (m *Metrics) ResetLatency() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, g := range m.groups {
+		g.submit.Reset()
+		g.receipt.Reset()
+	}
+}
+
+// Failures returns the submit failures of every group that sent, sorted
+// by group.
+func (m *Metrics) Failures() []GroupFailures {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := make([]GroupFailures, 0, len(m.groups))
+	for name, g := range m.groups {
+		list = append(list, g.failureCounts(name))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Group < list[j].Group })
+	return list
+}
+
+// ResetFailures drops the failures counted so far, the Prometheus
+// counters are kept.
+func (m *Metrics) ResetFailures() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, g := range m.groups {
+		g.mu.Lock()
+		g.failures = map[pdu.Status]uint64{}
+		g.errors = 0
+		g.mu.Unlock()
+	}
+}
+
+func (g *groupStats) failureCounts(name string) GroupFailures {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	f := GroupFailures{Group: name, Failures: []StatusCount{}, TransportErrors: g.errors}
+	for status, n := range g.failures {
+		f.Failures = append(f.Failures, StatusCount{
+			Status:      fmt.Sprintf("0x%08X", uint32(status)),
+			Name:        StatusName(status),
+			Description: statusDescription(status),
+			Count:       n,
+		})
+	}
+	sort.Slice(f.Failures, func(i, j int) bool {
+		if f.Failures[i].Count != f.Failures[j].Count {
+			return f.Failures[i].Count > f.Failures[j].Count
+		}
+		return f.Failures[i].Status < f.Failures[j].Status
+	})
+	return f
+}
+
+// connMetrics are the series of one connection, the submit series are
+// nil on receivers and deliverSM is nil on transmitters.
+type connMetrics struct {
+	m          *Metrics
+	labels     []string
+	messages   *prom.Counter
+	submits    *prom.Counter
+	timeouts   *prom.Counter
+	errors     *prom.Counter
+	deliverSM  *prom.Counter
+	up         *prom.Gauge
+	reconnects *prom.Counter
+	latency    *prom.Histogram
+	tps        *prom.Gauge
+	backoffs   *prom.Counter
+	group      *groupStats
+}
+
+// conn returns the series of connection i of a group, labeled with the
+// group name, or its index when it has none.
+func (m *Metrics) conn(group int, conf *config.SmppConfig, i int) *connMetrics {
+	name := conf.Name
+	if name == "" {
+		name = strconv.Itoa(group)
+	}
+	user, _ := conf.Account(i)
+	labels := []string{name, user, strings.ToLower(conf.Client.Type), strconv.Itoa(i)}
+	cm := &connMetrics{
+		m:          m,
+		labels:     labels,
+		up:         m.up.With(labels...),
+		reconnects: m.reconnects.With(labels...),
+	}
+	// only the series of what the bind type does
+	if conf.IsTransmitter() {
+		cm.messages = m.messages.With(labels...)
+		cm.submits = m.submits.With(labels...)
+		cm.timeouts = m.timeouts.With(labels...)
+		cm.errors = m.errors.With(labels...)
+		cm.latency = m.latency.With(labels...)
+		cm.tps = m.tps.With(labels...)
+		cm.backoffs = m.backoffs.With(labels...)
+		cm.group = m.group(name)
+	}
+	if !strings.EqualFold(conf.Client.Type, "transmitter") {
+		cm.deliverSM = m.deliverSM.With(labels...)
+	}
+	return cm
+}
+
+func (cm *connMetrics) failure(status pdu.Status) {
+	cm.m.failures.With(append(cm.labels, fmt.Sprintf("0x%08X", uint32(status)), StatusName(status))...).Inc()
+	cm.group.mu.Lock()
+	cm.group.failures[status]++
+	cm.group.mu.Unlock()
+}
+
+func (cm *connMetrics) bindFailure(class string) {
+	cm.m.bindFails.With(append(cm.labels, class)...).Inc()
+}
+
+func (cm *connMetrics) transportError() {
+	cm.errors.Inc()
+	cm.group.mu.Lock()
+	cm.group.errors++
+	cm.group.mu.Unlock()
+}
+
+func (cm *connMetrics) receipt(state string) {
+	cm.m.receipts.With(append(cm.labels, state)...).Inc()
+}
+
+func (cm *connMetrics) response(latency time.Duration) {
+	cm.latency.Observe(latency.Seconds())
+	cm.group.submit.Record(latency)
+}
+
+// receiptLatency is the histogram the tracker records the submit to
+// receipt latency of this connection in.
+func (cm *connMetrics) receiptLatency() *hdr.Histogram {
+	return cm.group.receipt
+}
@@ -0,0 +1,132 @@
+package smppclient
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/skill215/smpp-app/config"
+	"github.com/skill215/smpp-app/profile"
+)
+
+// groupProfile is a traffic profile driving the rate of one group.
+type groupProfile struct {
+	sched *profile.Scheduler
+	// started from the traffic-profile of the config rather than REST
+	fromConfig bool
+}
+
+// ProfileState is the progress of the traffic profile of a group.
+type ProfileState struct {
+	Group  int    `json:"group"`
+	Name   string `json:"name,omitempty"`
+	Source string `json:"source"`
+	profile.State
+}
+
+// StartProfile runs a traffic profile on the group addressed by name or
+// index, replacing the one it runs. Traffic must have been started.
+func (sh *SmppHandler) StartProfile(group string, p config.TrafficProfile) error {
+	sh.Lock()
+	defer sh.Unlock()
+	i, err := sh.groupIndex(group)
+	if err != nil {
+		return err
+	}
+	if !sh.conf[i].IsTransmitter() {
+		return fmt.Errorf("group %s is a receiver", group)
+	}
+	if !sh.running {
+		return errors.New("traffic is not started")
+	}
+	sh.startProfile(i, p, false)
+	return nil
+}
+
+// StopProfile stops the traffic profile of a group, its last rate stays.
+func (sh *SmppHandler) StopProfile(group string) error {
+	sh.Lock()
+	defer sh.Unlock()
+	i, err := sh.groupIndex(group)
+	if err != nil {
+		return err
+	}
+	if _, ok := sh.profiles[i]; !ok {
+		return fmt.Errorf("group %s runs no traffic profile", group)
+	}
+	sh.stopProfile(i)
+	return nil
+}
+
+// Profiles returns the progress of every running traffic profile.
+func (sh *SmppHandler) Profiles() []ProfileState {
+	sh.Lock()
+	defer sh.Unlock()
+	states := []ProfileState{}
+	for i := range sh.conf {
+		p, ok := sh.profiles[i]
+		if !ok {
+			continue
+		}
+		source := "rest"
+		if p.fromConfig {
+			source = "config"
+		}
+		states = append(states, ProfileState{
+			Group:  i,
+			Name:   sh.conf[i].Name,
+			Source: source,
+			State:  p.sched.State(),
+		})
+	}
+	return states
+}
+
+// startProfile runs p on group i, sh must be locked.
+func (sh *SmppHandler) startProfile(i int, p config.TrafficProfile, fromConfig bool) {
+	sh.stopProfile(i)
+	var sched *profile.Scheduler
+	sched = profile.NewScheduler(p, func(tps int) {
+		sh.Lock()
+		defer sh.Unlock()
+		// drop a rate computed just before the profile was stopped
+		if gp, ok := sh.profiles[i]; !ok || gp.sched != sched {
+			return
+		}
+		sh.setGroupTps(i, -1, tps)
+	})
+	sh.profiles[i] = &groupProfile{sched: sched, fromConfig: fromConfig}
+	sched.Start()
+	sh.log.WithFields(logrus.Fields{
+		"group":  i,
+		"phases": len(p.Phases),
+		"repeat": p.Repeat,
+	}).Info("Traffic profile started")
+}
+
+// startConfigProfiles starts the configured traffic profile of every
+// sending group that runs none, sh must be locked.
+func (sh *SmppHandler) startConfigProfiles() {
+	for i := range sh.conf {
+		p := sh.conf[i].Message.TrafficProfile
+		if _, ok := sh.profiles[i]; ok || len(p.Phases) == 0 || !sh.conf[i].IsTransmitter() {
+			continue
+		}
+		sh.startProfile(i, p, true)
+	}
+}
+
+// stopProfile stops the profile of group i if any, sh must be locked.
+func (sh *SmppHandler) stopProfile(i int) {
+	if p, ok := sh.profiles[i]; ok {
+		p.sched.Stop()
+		delete(sh.profiles, i)
+	}
+}
+
+// stopProfiles stops every profile, sh must be locked.
+func (sh *SmppHandler) stopProfiles() {
+	for i := range sh.profiles {
+		sh.stopProfile(i)
+	}
+}
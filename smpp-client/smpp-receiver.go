@@ -2,77 +2,113 @@ package smppclient
 
 import (
 	"context"
-	"fmt"
-	"time"
+	"sync"
 
 	gometrics "github.com/armon/go-metrics"
 	"github.com/sirupsen/logrus"
-	"github.com/skill215/go-smpp/smpp"
 	"github.com/skill215/go-smpp/smpp/pdu"
-	"github.com/skill215/smpp-app/broker"
 	"github.com/skill215/smpp-app/config"
+	"github.com/skill215/smpp-app/dlr"
 )
 
 type SmppReceiver struct {
-	log    *logrus.Logger
-	conf   *config.SmppConfig
-	rc     []smpp.Receiver
-	inm    *gometrics.InmemSink
-	broker *broker.Broker
+	sync.Mutex
+	log     *logrus.Logger
+	group   int // index in the config
+	conf    *config.SmppConfig
+	rc      []*connection
+	inm     *gometrics.InmemSink
+	tracker *dlr.Tracker
+	metrics *Metrics
+	cancel  context.CancelFunc
+	states  connStates
+	wg      sync.WaitGroup
 }
 
-func ProvideSmppReceiver(ctx context.Context, conf config.SmppConfig, inm *gometrics.InmemSink, broker *broker.Broker, log *logrus.Logger) *SmppReceiver {
+func ProvideSmppReceiver(ctx context.Context, group int, conf config.SmppConfig, inm *gometrics.InmemSink, tracker *dlr.Tracker, metrics *Metrics, log *logrus.Logger) *SmppReceiver {
 	sr := SmppReceiver{
-		conf:   &conf,
-		inm:    inm,
-		log:    log,
-		broker: broker,
-		rc:     []smpp.Receiver{},
+		group:   group,
+		conf:    &conf,
+		inm:     inm,
+		log:     log,
+		tracker: tracker,
+		metrics: metrics,
+		rc:      []*connection{},
 	}
 	return &sr
 }
 
 func (sr *SmppReceiver) Init() {
 	sr.log.Infof("smpp receiver init")
-	for i := 0; i < int(sr.conf.Client.Count); i++ {
-		rc := smpp.Receiver{
-			Addr:   fmt.Sprintf("%s:%d", sr.conf.Server.Addr, sr.conf.Server.Port),
-			User:   sr.conf.Server.User,
-			Passwd: sr.conf.Server.Password,
-		}
-		sr.rc = append(sr.rc, rc)
-		sr.bind(&rc)
-	}
 }
 
-func (sr *SmppReceiver) bind(rc *smpp.Receiver) {
-	conn := rc.Bind()
-	rc.Handler = sr.handleAT
-
-	// goroutine to reconnect
+func (sr *SmppReceiver) bind(ctx context.Context, conn *connection) {
+	sr.wg.Add(1)
+	// goroutine to bind and reconnect
 	go func() {
-		for {
-			status := <-conn
-			if status.Error() != nil || status.Status().String() != "Connected" {
-				time.Sleep(5 * time.Second)
-				conn = rc.Bind()
-			}
-		}
+		defer sr.wg.Done()
+		conn.run(ctx)
 	}()
 }
 
-func (sr *SmppReceiver) Start(tps int) {
+// Start binds all receivers of the group, the rates are ignored.
+func (sr *SmppReceiver) Start(rates []int) {
+	sr.Lock()
+	defer sr.Unlock()
+	if sr.cancel != nil {
+		return
+	}
 
+	ctx, cancel := context.WithCancel(context.Background())
+	sr.cancel = cancel
+	for i := 0; i < int(sr.conf.Client.Count); i++ {
+		sr.rc = append(sr.rc, newConnection(sr.group, i, sr.conf, &sr.states, sr.metrics, sr.log, sr.handleAT))
+	}
+	sr.states.reset(sr.rc)
+	for _, conn := range sr.rc {
+		sr.bind(ctx, conn)
+	}
 }
 
+// Stop unbinds every receiver of the group. The client can be started
+// again afterwards.
 func (sr *SmppReceiver) Stop() {
+	sr.Lock()
+	defer sr.Unlock()
+	if sr.cancel == nil {
+		return
+	}
+
+	sr.cancel()
+	sr.wg.Wait()
+	sr.log.WithField("conn_num", len(sr.rc)).Info("SMPP receiver stopped")
+	sr.rc = []*connection{}
+	sr.cancel = nil
+	sr.states.reset(nil)
+}
+
+// SetRates is a no-op, receivers do not send.
+func (sr *SmppReceiver) SetRates(rates []int) {}
 
+// State returns the bind state of every connection, empty when stopped.
+func (sr *SmppReceiver) State() []ConnState {
+	return sr.states.list()
 }
 
-func (sr *SmppReceiver) handleAT(p pdu.Body) {
+// Control applies a manual action to connection conn, to all of them with
+// -1.
+func (sr *SmppReceiver) Control(conn int, action string) error {
+	return sr.states.control(conn, action)
+}
+
+// Update is a no-op, receivers have no message settings.
+func (sr *SmppReceiver) Update(conf config.SmppConfig) {}
+
+func (sr *SmppReceiver) handleAT(conn *connection, p pdu.Body) {
 	sr.log.Debugf("receive AT, ID: %s, Status: %s", p.Header().ID.String(), p.Header().Status.Error())
 	sr.inm.IncrCounter([]string{"at"}, 1)
 	if p.Header().Status != 0x00000000 {
 		sr.inm.IncrCounter([]string{"at failure"}, 1)
 	}
+	handleReceipt(sr.log, sr.tracker, conn, p, sr.conf.Message.Send.OrphanTimeout)
 }
@@ -0,0 +1,68 @@
+package smppclient
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/skill215/go-smpp/smpp/pdu"
+	"github.com/skill215/smpp-app/config"
+)
+
+// bind_resp statuses of a rejected system_id or password
+const (
+	statusInvPaswd pdu.Status = 0x0E // ESME_RINVPASWD
+	statusInvSysID pdu.Status = 0x0F // ESME_RINVSYSID
+)
+
+// statusGaveUp is the state of a connection that stopped binding again.
+const statusGaveUp = "Gave up"
+
+// reconnectPolicy spaces the binds of a connection out exponentially, and
+// tells which bind failures it gives up on.
+type reconnectPolicy struct {
+	conf config.ReconnectConfig
+}
+
+// bindFailure returns the class of an error of dialSession: auth or
+// rejected for a bind_resp error, network for anything else.
+func bindFailure(err error) string {
+	var status pdu.Status
+	if !errors.As(err, &status) {
+		return config.BindFailureNetwork
+	}
+	if status == statusInvPaswd || status == statusInvSysID {
+		return config.BindFailureAuth
+	}
+	return config.BindFailureRejected
+}
+
+// fatal reports whether a bind failure of class ends the reconnects.
+func (p reconnectPolicy) fatal(class string) bool {
+	for _, c := range p.conf.Fatal {
+		if strings.EqualFold(c, class) {
+			return true
+		}
+	}
+	return false
+}
+
+// exhausted reports whether failures binds in a row are all the policy
+// allows.
+func (p reconnectPolicy) exhausted(failures int) bool {
+	return p.conf.MaxAttempts > 0 && failures >= p.conf.MaxAttempts
+}
+
+// delay returns the wait before the next bind after failures failed binds
+// in a row, a lost session waits as long as one failed bind. u in [0, 1)
+// places the delay within the jitter.
+func (p reconnectPolicy) delay(failures int, u float64) time.Duration {
+	if failures < 1 {
+		failures = 1
+	}
+	d := float64(p.conf.InitialDelay) * math.Pow(p.conf.Multiplier, float64(failures-1))
+	d = math.Min(d, float64(p.conf.MaxDelay))
+	d *= 1 + p.conf.Jitter*(2*u-1)
+	return time.Duration(d)
+}
@@ -0,0 +1,48 @@
+package smppclient
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/skill215/go-smpp/smpp/pdu"
+	"github.com/skill215/smpp-app/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func testReconnect() reconnectPolicy {
+	return reconnectPolicy{conf: config.ReconnectConfig{
+		InitialDelay: time.Second,
+		MaxDelay:     10 * time.Second,
+		Multiplier:   2,
+		Jitter:       0.2,
+		MaxAttempts:  5,
+		Fatal:        []string{"auth"},
+	}}
+}
+
+func TestReconnectDelay(t *testing.T) {
+	p := testReconnect()
+	// u 0.5 is the middle of the jitter
+	for failures, want := range []time.Duration{time.Second, time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second} {
+		assert.Equal(t, want, p.delay(failures, 0.5), failures)
+	}
+	assert.Equal(t, 3200*time.Millisecond, p.delay(3, 0))
+	assert.Equal(t, 12*time.Second, p.delay(9, 1))
+}
+
+func TestBindFailure(t *testing.T) {
+	assert.Equal(t, config.BindFailureAuth, bindFailure(pdu.Status(0x0E)))
+	assert.Equal(t, config.BindFailureAuth, bindFailure(pdu.Status(0x0F)))
+	assert.Equal(t, config.BindFailureRejected, bindFailure(pdu.Status(0x0D)))
+	assert.Equal(t, config.BindFailureNetwork, bindFailure(&net.OpError{Op: "dial", Err: errors.New("connection refused")}))
+
+	p := testReconnect()
+	assert.True(t, p.fatal(config.BindFailureAuth))
+	assert.False(t, p.fatal(config.BindFailureNetwork))
+	assert.False(t, p.exhausted(4))
+	assert.True(t, p.exhausted(5))
+	p.conf.MaxAttempts = 0
+	assert.False(t, p.exhausted(1000))
+}
@@ -0,0 +1,106 @@
+package smppclient
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skill215/go-smpp/smpp"
+)
+
+// ConnInfo is one connection of the registry, with the group it belongs
+// to.
+type ConnInfo struct {
+	Group    int    `json:"group"`
+	Name     string `json:"name,omitempty"`
+	Type     string `json:"bind_type"`
+	Addr     string `json:"addr"`
+	SystemID string `json:"system_id"`
+	ConnState
+}
+
+// Connections is the registry of every connection returned by the REST
+// API. Total is the configured connections, Bound those bound, Conns is
+// empty while the traffic is stopped.
+type Connections struct {
+	Total int        `json:"total"`
+	Bound int        `json:"bound"`
+	Conns []ConnInfo `json:"connections"`
+}
+
+// Connections returns the connections of the group addressed by name or
+// index, of every group when group is empty.
+func (sh *SmppHandler) Connections(group string) (Connections, error) {
+	sh.Lock()
+	defer sh.Unlock()
+	groups := []int{}
+	if group == "" {
+		for i := range sh.clients {
+			groups = append(groups, i)
+		}
+	} else {
+		i, err := sh.groupIndex(group)
+		if err != nil {
+			return Connections{}, err
+		}
+		groups = append(groups, i)
+	}
+	conns := Connections{Conns: []ConnInfo{}}
+	for _, i := range groups {
+		conf := sh.conf[i]
+		conns.Total += int(conf.Client.Count)
+		for _, st := range sh.clients[i].State() {
+			user, _ := conf.Account(st.Index)
+			conns.Conns = append(conns.Conns, ConnInfo{
+				Group:     i,
+				Name:      conf.Name,
+				Type:      strings.ToLower(conf.Client.Type),
+				Addr:      fmt.Sprintf("%s:%d", conf.Server.Addr, conf.Server.Port),
+				SystemID:  user,
+				ConnState: st,
+			})
+			if st.Status == smpp.Connected.String() {
+				conns.Bound++
+			}
+		}
+	}
+	return conns, nil
+}
+
+// rateMeter counts events by second, its rate is the count of the last
+// full second.
+type rateMeter struct {
+	mu    sync.Mutex
+	sec   int64 // unix second being counted
+	count int64
+	last  int64 // count of sec-1
+}
+
+func (m *rateMeter) add(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.roll(now.Unix())
+	m.count++
+}
+
+func (m *rateMeter) rate(now time.Time) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.roll(now.Unix())
+	return m.last
+}
+
+// roll moves the meter on to second sec.
+func (m *rateMeter) roll(sec int64) {
+	switch {
+	case sec == m.sec:
+		return
+	case sec == m.sec+1:
+		m.last = m.count
+	default:
+		m.last = 0
+	}
+	m.sec = sec
+	m.count = 0
+}
@@ -0,0 +1,42 @@
+package smppclient
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/skill215/go-smpp/smpp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateMeter(t *testing.T) {
+	m := rateMeter{}
+	now := time.Unix(1000, 0)
+	for i := 0; i < 5; i++ {
+		m.add(now)
+	}
+	assert.Equal(t, int64(0), m.rate(now.Add(500*time.Millisecond)))
+	assert.Equal(t, int64(5), m.rate(now.Add(time.Second)))
+	m.add(now.Add(1500 * time.Millisecond))
+	assert.Equal(t, int64(5), m.rate(now.Add(1900*time.Millisecond)))
+	assert.Equal(t, int64(1), m.rate(now.Add(2*time.Second)))
+	// an idle second in between
+	assert.Equal(t, int64(0), m.rate(now.Add(4*time.Second)))
+}
+
+func TestConnStates(t *testing.T) {
+	cs := connStates{}
+	cs.reset([]*connection{{}})
+	cs.set(0, smpp.ConnectionFailed.String(), errors.New("refused"))
+	cs.set(0, smpp.Connected.String(), nil)
+	c := cs.list()[0]
+	assert.NotNil(t, c.BoundAt)
+	assert.Equal(t, c.Since, *c.BoundAt)
+	assert.Empty(t, c.Error)
+	assert.Equal(t, "refused", c.LastError)
+
+	cs.set(0, smpp.Disconnected.String(), errors.New("EOF"))
+	c = cs.list()[0]
+	assert.Nil(t, c.BoundAt)
+	assert.Equal(t, "EOF", c.LastError)
+}
@@ -0,0 +1,436 @@
+package smppclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/skill215/go-smpp/smpp/pdu"
+	"github.com/skill215/go-smpp/smpp/pdu/pdufield"
+	"github.com/skill215/smpp-app/config"
+)
+
+var (
+	// ErrRespTimeout completes a request that got no response within the
+	// response timeout of its session.
+	ErrRespTimeout = errors.New("smpp: response timeout")
+	// ErrSessionClosed completes the requests still outstanding when the
+	// session goes down, and is returned for requests sent afterwards.
+	ErrSessionClosed = errors.New("smpp: session closed")
+)
+
+const (
+	// bindTimeout bounds the connect and the wait for the bind response.
+	bindTimeout = 10 * time.Second
+	// enquireLinkInterval is the idle time between two enquire_link.
+	enquireLinkInterval = 10 * time.Second
+	// unbindTimeout is how long Close waits for unbind_resp.
+	unbindTimeout = time.Second
+)
+
+// sessionConfig is what a session needs to bind and send.
+type sessionConfig struct {
+	addr     string
+	bindID   pdu.ID // BindTransmitterID, BindReceiverID or BindTransceiverID
+	systemID string
+	password string
+	// the other bind fields
+	systemType       string
+	interfaceVersion uint8
+	addrTON          uint8
+	addrNPI          uint8
+	addressRange     string
+	// SMPP over TLS, nil for plain TCP
+	tls *config.TLSConfig
+	// submit_sm outstanding at most, other requests do not count
+	window      int
+	respTimeout time.Duration
+	// handler gets every deliver_sm and data_sm, the response is sent by
+	// the session once it returns
+	handler func(pdu.Body)
+}
+
+// request is a PDU sent by the session waiting for its response.
+type request struct {
+	windowed bool
+	sent     time.Time
+	timer    *time.Timer
+	done     func(resp pdu.Body, latency time.Duration, err error)
+}
+
+// session is one bound SMPP connection. Requests are written without
+// waiting for the previous response, responses are matched to them by
+// sequence number and requests without a response are completed with
+// ErrRespTimeout.
+type session struct {
+	conf sessionConfig
+	conn net.Conn
+	r    *bufio.Reader
+
+	wmu sync.Mutex
+	w   *bufio.Writer
+
+	// holds a token per outstanding submit_sm
+	window chan struct{}
+
+	mu      sync.Mutex
+	pending map[uint32]*request
+
+	// unix nanoseconds of the last enquire_link answered either way
+	enquireLinked int64
+
+	closeOnce sync.Once
+	closed    chan struct{}
+	err       error
+}
+
+// dialSession connects and binds, the session is ready to send when no
+// error is returned. A bind rejected by the SMSC returns its pdu.Status.
+func dialSession(ctx context.Context, conf sessionConfig) (*session, error) {
+	d := net.Dialer{Timeout: bindTimeout}
+	var conn net.Conn
+	var err error
+	if conf.tls != nil {
+		tc, tlsErr := conf.tls.ClientConfig()
+		if tlsErr != nil {
+			return nil, tlsErr
+		}
+		// the handshake is part of the dial
+		td := tls.Dialer{NetDialer: &d, Config: tc}
+		conn, err = td.DialContext(ctx, "tcp", conf.addr)
+	} else {
+		conn, err = d.DialContext(ctx, "tcp", conf.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if conf.window < 1 {
+		conf.window = 1
+	}
+	s := &session{
+		conf:    conf,
+		conn:    conn,
+		r:       bufio.NewReader(conn),
+		w:       bufio.NewWriter(conn),
+		window:  make(chan struct{}, conf.window),
+		pending: map[uint32]*request{},
+		closed:  make(chan struct{}),
+	}
+	if err := s.bind(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	go s.read()
+	go s.enquireLink()
+	return s, nil
+}
+
+func (s *session) bind() error {
+	var p pdu.Body
+	switch s.conf.bindID {
+	case pdu.BindReceiverID:
+		p = pdu.NewBindReceiver()
+	case pdu.BindTransceiverID:
+		p = pdu.NewBindTransceiver()
+	default:
+		p = pdu.NewBindTransmitter()
+	}
+	f := p.Fields()
+	f.Set(pdufield.SystemID, s.conf.systemID)
+	f.Set(pdufield.Password, s.conf.password)
+	f.Set(pdufield.SystemType, s.conf.systemType)
+	f.Set(pdufield.InterfaceVersion, s.conf.interfaceVersion)
+	f.Set(pdufield.AddrTON, s.conf.addrTON)
+	f.Set(pdufield.AddrNPI, s.conf.addrNPI)
+	f.Set(pdufield.AddressRange, s.conf.addressRange)
+
+	s.conn.SetDeadline(time.Now().Add(bindTimeout))
+	defer s.conn.SetDeadline(time.Time{})
+	if err := s.write(p); err != nil {
+		return err
+	}
+	resp, err := pdu.Decode(s.r)
+	if err != nil {
+		return err
+	}
+	h := resp.Header()
+	if h.ID != p.Header().ID|0x80000000 && h.ID != pdu.GenericNACKID {
+		return fmt.Errorf("unexpected bind response %s", h.ID)
+	}
+	if h.Status != 0 {
+		return h.Status
+	}
+	return nil
+}
+
+// write sends p, a write that fails or does not complete within the
+// response timeout takes the session down.
+func (s *session) write(p pdu.Body) error {
+	var b bytes.Buffer
+	if err := p.SerializeTo(&b); err != nil {
+		return err
+	}
+	s.wmu.Lock()
+	// an SMSC that stops reading would block every writer for good
+	s.conn.SetWriteDeadline(time.Now().Add(s.conf.respTimeout))
+	_, err := s.w.Write(b.Bytes())
+	if err == nil {
+		err = s.w.Flush()
+	}
+	s.wmu.Unlock()
+	if err != nil {
+		s.fail(err)
+	}
+	return err
+}
+
+// Submit sends a submit_sm once the window has room, blocking until then
+// or until ctx is done. done is called exactly once with the response and
+// the time it took, or with ErrRespTimeout or ErrSessionClosed, when
+// Submit returns nil.
+func (s *session) Submit(ctx context.Context, p pdu.Body, done func(resp pdu.Body, latency time.Duration, err error)) error {
+	select {
+	case s.window <- struct{}{}:
+	case <-s.closed:
+		return ErrSessionClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return s.send(p, true, done)
+}
+
+// send registers p as pending before writing it, a windowed request
+// already holds its window token.
+func (s *session) send(p pdu.Body, windowed bool, done func(resp pdu.Body, latency time.Duration, err error)) error {
+	seq := p.Header().Seq
+	req := &request{windowed: windowed, sent: time.Now(), done: done}
+	s.mu.Lock()
+	if s.pending == nil {
+		s.mu.Unlock()
+		if windowed {
+			<-s.window
+		}
+		return ErrSessionClosed
+	}
+	s.pending[seq] = req
+	req.timer = time.AfterFunc(s.conf.respTimeout, func() {
+		s.complete(seq, nil, ErrRespTimeout)
+	})
+	s.mu.Unlock()
+
+	// a failed write completes the request with ErrSessionClosed
+	s.write(p)
+	return nil
+}
+
+// complete hands the outcome of the request seq to its callback, unless
+// it was completed before.
+func (s *session) complete(seq uint32, resp pdu.Body, err error) bool {
+	s.mu.Lock()
+	req := s.pending[seq]
+	delete(s.pending, seq)
+	s.mu.Unlock()
+	if req == nil {
+		return false
+	}
+	req.timer.Stop()
+	if req.windowed {
+		<-s.window
+	}
+	req.done(resp, time.Since(req.sent), err)
+	return true
+}
+
+// request sends p outside the window and waits for its response.
+func (s *session) request(p pdu.Body) (pdu.Body, error) {
+	type result struct {
+		resp pdu.Body
+		err  error
+	}
+	ch := make(chan result, 1)
+	if err := s.send(p, false, func(resp pdu.Body, _ time.Duration, err error) {
+		ch <- result{resp, err}
+	}); err != nil {
+		return nil, err
+	}
+	r := <-ch
+	return r.resp, r.err
+}
+
+func (s *session) read() {
+	for {
+		p, err := pdu.Decode(s.r)
+		if err != nil {
+			s.fail(err)
+			return
+		}
+		h := p.Header()
+		switch h.ID {
+		case pdu.EnquireLinkID:
+			s.write(pdu.NewEnquireLinkRespSeq(h.Seq))
+			s.linked()
+		case pdu.UnbindID:
+			resp := pdu.NewUnbindResp()
+			resp.Header().Seq = h.Seq
+			s.write(resp)
+			s.fail(errors.New("unbound by the SMSC"))
+			return
+		case pdu.DeliverSMID, pdu.DataSMID:
+			if s.conf.handler != nil {
+				s.conf.handler(p)
+			}
+			var resp pdu.Body
+			if h.ID == pdu.DeliverSMID {
+				resp = pdu.NewDeliverSMRespSeq(h.Seq)
+			} else {
+				resp = pdu.NewDataSMResp()
+				resp.Header().Seq = h.Seq
+			}
+			s.write(resp)
+		default:
+			if h.ID&0x80000000 != 0 {
+				// a response arriving after its timeout is dropped
+				s.complete(h.Seq, p, nil)
+				continue
+			}
+			nack := pdu.NewGenericNACK()
+			nack.Header().Seq = h.Seq
+			nack.Header().Status = 0x03 // ESME_RINVCMDID
+			s.write(nack)
+		}
+	}
+}
+
+// enquireLink keeps the link checked while it is idle, a missing
+// enquire_link_resp takes the session down.
+func (s *session) enquireLink() {
+	t := time.NewTicker(enquireLinkInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.closed:
+			return
+		case <-t.C:
+			if _, err := s.request(pdu.NewEnquireLink()); err != nil {
+				s.fail(fmt.Errorf("enquire_link: %w", err))
+				return
+			}
+			s.linked()
+		}
+	}
+}
+
+func (s *session) linked() {
+	atomic.StoreInt64(&s.enquireLinked, time.Now().UnixNano())
+}
+
+// lastEnquireLink returns when an enquire_link was last answered, by
+// either side, zero if none was yet.
+func (s *session) lastEnquireLink() time.Time {
+	if n := atomic.LoadInt64(&s.enquireLinked); n != 0 {
+		return time.Unix(0, n)
+	}
+	return time.Time{}
+}
+
+// inFlight returns the requests waiting for their response.
+func (s *session) inFlight() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.pending)
+}
+
+// fail closes the connection and completes every pending request with
+// ErrSessionClosed. Only the first error is kept.
+func (s *session) fail(err error) {
+	s.closeOnce.Do(func() {
+		s.err = err
+		close(s.closed)
+		s.conn.Close()
+
+		s.mu.Lock()
+		pending := s.pending
+		s.pending = nil
+		s.mu.Unlock()
+		for _, req := range pending {
+			req.timer.Stop()
+			if req.windowed {
+				<-s.window
+			}
+			req.done(nil, time.Since(req.sent), ErrSessionClosed)
+		}
+	})
+}
+
+// Done is closed once the session is down.
+func (s *session) Done() <-chan struct{} {
+	return s.closed
+}
+
+// Err returns why the session went down, nil while it is up.
+func (s *session) Err() error {
+	select {
+	case <-s.closed:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+// Reset closes the connection without unbind, with a TCP reset where the
+// connection allows it.
+func (s *session) Reset() {
+	conn := s.conn
+	if tc, ok := conn.(*tls.Conn); ok {
+		conn = tc.NetConn()
+	}
+	if tc, ok := conn.(*net.TCPConn); ok {
+		tc.SetLinger(0)
+	}
+	s.fail(ErrSessionClosed)
+}
+
+// tlsState returns the negotiated TLS version and cipher suite, empty on
+// plain TCP.
+func (s *session) tlsState() (version, cipher string) {
+	tc, ok := s.conn.(*tls.Conn)
+	if !ok {
+		return "", ""
+	}
+	cs := tc.ConnectionState()
+	return config.TLSVersionName(cs.Version), tls.CipherSuiteName(cs.CipherSuite)
+}
+
+// Close waits up to the response timeout for the outstanding submit_sm,
+// unbinds, waiting up to unbindTimeout for the response, and closes the
+// connection.
+func (s *session) Close() {
+	// taking every window token keeps further submit_sm out
+	t := time.NewTimer(s.conf.respTimeout)
+	defer t.Stop()
+drain:
+	for i := 0; i < cap(s.window); i++ {
+		select {
+		case s.window <- struct{}{}:
+		case <-s.closed:
+			break drain
+		case <-t.C:
+			break drain
+		}
+	}
+	done := make(chan struct{})
+	if err := s.send(pdu.NewUnbind(), false, func(pdu.Body, time.Duration, error) { close(done) }); err == nil {
+		select {
+		case <-done:
+		case <-time.After(unbindTimeout):
+		}
+	}
+	s.fail(ErrSessionClosed)
+}
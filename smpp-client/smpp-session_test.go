@@ -0,0 +1,394 @@
+package smppclient
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/skill215/go-smpp/smpp/pdu"
+	"github.com/skill215/go-smpp/smpp/pdu/pdufield"
+	"github.com/skill215/go-smpp/smpp/pdu/pdutext"
+	"github.com/skill215/smpp-app/config"
+	"github.com/skill215/smpp-app/smsc"
+	"github.com/stretchr/testify/assert"
+)
+
+func startSmsc(t *testing.T, latency time.Duration) string {
+	return startSmscServer(t, latency).Addr()
+}
+
+func startSmscServer(t *testing.T, latency time.Duration) *smsc.Server {
+	conf := config.SmscConfig{}
+	conf.Submit.Latency = latency
+	srv := smsc.New(conf, logrus.New())
+	if err := srv.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func testSession(t *testing.T, addr string, window int, respTimeout time.Duration) *session {
+	s, err := dialSession(context.Background(), sessionConfig{
+		addr:        addr,
+		bindID:      pdu.BindTransmitterID,
+		systemID:    "user",
+		window:      window,
+		respTimeout: respTimeout,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+func testSubmit() pdu.Body {
+	p := pdu.NewSubmitSM(nil)
+	f := p.Fields()
+	f.Set(pdufield.SourceAddr, "1234")
+	f.Set(pdufield.DestinationAddr, "5678")
+	f.Set(pdufield.ShortMessage, pdutext.Raw("hello"))
+	return p
+}
+
+// submitN sends n submit_sm and returns how long it took until the last
+// response, failing on any error.
+func submitN(t *testing.T, s *session, n int) time.Duration {
+	begin := time.Now()
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		err := s.Submit(context.Background(), testSubmit(), func(resp pdu.Body, _ time.Duration, err error) {
+			if err == nil && resp.Header().ID != pdu.SubmitSMRespID {
+				err = resp.Header().Status
+			}
+			errs <- err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < n; i++ {
+		assert.Nil(t, <-errs)
+	}
+	return time.Since(begin)
+}
+
+func TestSessionWindowThroughput(t *testing.T) {
+	addr := startSmsc(t, 20*time.Millisecond)
+	const n = 20
+
+	serial := submitN(t, testSession(t, addr, 1, time.Second), n)
+	windowed := submitN(t, testSession(t, addr, 10, time.Second), n)
+	assert.GreaterOrEqual(t, int64(serial), int64(n*20*time.Millisecond))
+	assert.Less(t, int64(windowed), int64(serial/3))
+}
+
+func TestSessionRespTimeout(t *testing.T) {
+	addr := startSmsc(t, 300*time.Millisecond)
+	s := testSession(t, addr, 2, 50*time.Millisecond)
+
+	errs := make(chan error, 1)
+	assert.Nil(t, s.Submit(context.Background(), testSubmit(), func(resp pdu.Body, _ time.Duration, err error) {
+		errs <- err
+	}))
+	select {
+	case err := <-errs:
+		assert.Equal(t, ErrRespTimeout, err)
+	case <-time.After(time.Second):
+		t.Fatal("no timeout")
+	}
+	// the timed out request gave its window slot back
+	assert.Equal(t, 0, len(s.window))
+}
+
+func TestSessionWindowLimit(t *testing.T) {
+	addr := startSmsc(t, 200*time.Millisecond)
+	s := testSession(t, addr, 3, time.Second)
+
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, s.Submit(context.Background(), testSubmit(), func(resp pdu.Body, _ time.Duration, err error) {
+			errs <- err
+		}))
+	}
+	assert.Equal(t, 3, s.inFlight())
+	// a full window holds the next submit until a response frees a slot
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, s.Submit(ctx, testSubmit(), func(pdu.Body, time.Duration, error) {
+		t.Error("a submit held by the window was sent")
+	}))
+	assert.Equal(t, 3, s.inFlight())
+
+	done := make(chan error, 1)
+	assert.Nil(t, s.Submit(context.Background(), testSubmit(), func(resp pdu.Body, _ time.Duration, err error) {
+		done <- err
+	}))
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, <-errs)
+	}
+	assert.Nil(t, <-done)
+	assert.Equal(t, 0, s.inFlight())
+}
+
+func TestSessionLateResponse(t *testing.T) {
+	addr := startSmsc(t, 200*time.Millisecond)
+	s := testSession(t, addr, 2, 50*time.Millisecond)
+
+	var calls int32
+	errs := make(chan error, 2)
+	assert.Nil(t, s.Submit(context.Background(), testSubmit(), func(resp pdu.Body, _ time.Duration, err error) {
+		atomic.AddInt32(&calls, 1)
+		errs <- err
+	}))
+	assert.Equal(t, ErrRespTimeout, <-errs)
+	// the response arrives after the timeout and is dropped: the callback
+	// is not called again, no slot is freed twice and the session stays up
+	time.Sleep(300 * time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	assert.Equal(t, 0, len(s.window))
+	assert.Equal(t, 0, s.inFlight())
+	assert.Nil(t, s.Err())
+
+	s.conf.respTimeout = time.Second
+	submitN(t, s, 2)
+}
+
+func TestSessionUnbindMidWindow(t *testing.T) {
+	srv := startSmscServer(t, 300*time.Millisecond)
+	s := testSession(t, srv.Addr(), 5, time.Second)
+
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, s.Submit(context.Background(), testSubmit(), func(resp pdu.Body, _ time.Duration, err error) {
+			errs <- err
+		}))
+	}
+	srv.Unbind()
+	select {
+	case <-s.Done():
+	case <-time.After(time.Second):
+		t.Fatal("the session is still up")
+	}
+	// every submit of the window completes without its response
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, ErrSessionClosed, <-errs)
+	}
+	assert.EqualError(t, s.Err(), "unbound by the SMSC")
+	assert.Equal(t, 0, len(s.window))
+	assert.Equal(t, ErrSessionClosed, s.Submit(context.Background(), testSubmit(), func(pdu.Body, time.Duration, error) {
+		t.Error("a submit was sent on a closed session")
+	}))
+	// the SMSC got the unbind_resp and dropped the session
+	deadline := time.Now().Add(time.Second)
+	for srv.Sessions() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, 0, srv.Sessions())
+}
+
+func TestSessionWriteTimeout(t *testing.T) {
+	// the SMSC end of the pipe is never read
+	conn, smscConn := net.Pipe()
+	defer smscConn.Close()
+	s := &session{
+		conf:    sessionConfig{window: 1, respTimeout: 50 * time.Millisecond},
+		conn:    conn,
+		w:       bufio.NewWriter(conn),
+		window:  make(chan struct{}, 1),
+		pending: map[uint32]*request{},
+		closed:  make(chan struct{}),
+	}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.Submit(context.Background(), testSubmit(), func(resp pdu.Body, _ time.Duration, err error) {
+			errs <- err
+		})
+	}()
+	// the blocked write takes the session down instead of the writer
+	select {
+	case <-s.Done():
+	case <-time.After(time.Second):
+		t.Fatal("the write is still blocked")
+	}
+	assert.Equal(t, ErrSessionClosed, <-errs)
+	assert.Nil(t, <-errs)
+	var nerr net.Error
+	assert.ErrorAs(t, s.Err(), &nerr)
+	assert.True(t, nerr.Timeout())
+}
+
+func TestSessionBindRejected(t *testing.T) {
+	conf := config.SmscConfig{Users: []config.SmscUser{{User: "smpp1", Password: "smpp"}}}
+	srv := smsc.New(conf, logrus.New())
+	if err := srv.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve()
+	defer srv.Close()
+
+	_, err := dialSession(context.Background(), sessionConfig{
+		addr:        srv.Addr(),
+		bindID:      pdu.BindTransmitterID,
+		systemID:    "smpp1",
+		password:    "wrong",
+		respTimeout: time.Second,
+	})
+	_, ok := err.(pdu.Status)
+	assert.True(t, ok, "got %v", err)
+}
+
+// startTLSProxy terminates TLS for the plain SMSC at addr with a self
+// signed certificate for 127.0.0.1, it returns its address and the PEM
+// file of the certificate.
+func startTLSProxy(t *testing.T, addr string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "smsc"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			upstream, err := net.Dial("tcp", addr)
+			if err != nil {
+				conn.Close()
+				continue
+			}
+			go func() {
+				io.Copy(upstream, conn)
+				upstream.Close()
+			}()
+			go func() {
+				io.Copy(conn, upstream)
+				conn.Close()
+			}()
+		}
+	}()
+	return l.Addr().String(), ca
+}
+
+func TestSessionTLS(t *testing.T) {
+	addr, ca := startTLSProxy(t, startSmsc(t, 0))
+	conf := sessionConfig{
+		addr:        addr,
+		bindID:      pdu.BindTransmitterID,
+		systemID:    "user",
+		respTimeout: time.Second,
+		tls:         &config.TLSConfig{Enable: true, CA: ca, MinVersion: "1.2"},
+	}
+	s, err := dialSession(context.Background(), conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, cipher := s.tlsState()
+	assert.Equal(t, "TLS1.3", version)
+	assert.NotEmpty(t, cipher)
+	submitN(t, s, 3)
+	s.Reset()
+	<-s.Done()
+
+	// the certificate is not for another name
+	conf.tls.ServerName = "smsc.example.com"
+	_, err = dialSession(context.Background(), conf)
+	assert.NotNil(t, err)
+	conf.tls.InsecureSkipVerify = true
+	s, err = dialSession(context.Background(), conf)
+	assert.Nil(t, err)
+	s.Close()
+}
+
+func TestSessionBindFields(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	binds := make(chan pdu.Body, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		p, err := pdu.Decode(conn)
+		if err != nil {
+			return
+		}
+		binds <- p
+		resp := pdu.NewBindTransmitterResp()
+		resp.Header().Seq = p.Header().Seq
+		resp.SerializeTo(conn)
+		io.Copy(io.Discard, conn)
+	}()
+
+	s, err := dialSession(context.Background(), sessionConfig{
+		addr:             l.Addr().String(),
+		bindID:           pdu.BindTransmitterID,
+		systemID:         "user2",
+		password:         "secret",
+		systemType:       "VMA",
+		interfaceVersion: 0x50,
+		addrTON:          1,
+		addrNPI:          1,
+		addressRange:     "^447",
+		respTimeout:      time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.fail(ErrSessionClosed)
+	f := (<-binds).Fields()
+	assert.Equal(t, "user2", f[pdufield.SystemID].String())
+	assert.Equal(t, "secret", f[pdufield.Password].String())
+	assert.Equal(t, "VMA", f[pdufield.SystemType].String())
+	assert.Equal(t, []byte{0x50}, f[pdufield.InterfaceVersion].Bytes())
+	assert.Equal(t, []byte{1}, f[pdufield.AddrTON].Bytes())
+	assert.Equal(t, []byte{1}, f[pdufield.AddrNPI].Bytes())
+	assert.Equal(t, "^447", f[pdufield.AddressRange].String())
+}
@@ -0,0 +1,26 @@
+package smppclient
+
+import (
+	"testing"
+
+	"github.com/skill215/go-smpp/smpp/pdu"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusName(t *testing.T) {
+	for status, name := range map[pdu.Status]string{
+		0x0B:  "ESME_RINVDSTADR",
+		0x58:  "ESME_RTHROTTLED",
+		0x08:  "ESME_RSYSERR",
+		0x104: "ESME_RINVDCS",
+		0x400: "VENDOR_0x00000400",
+		0x4FF: "VENDOR_0x000004FF",
+		0x09:  "RESERVED_0x00000009",
+		0x500: "RESERVED_0x00000500",
+	} {
+		assert.Equal(t, name, StatusName(status))
+	}
+	assert.Equal(t, "invalid destination address", statusDescription(0x0B))
+	assert.Equal(t, "SMSC vendor specific error", statusDescription(0x401))
+	assert.Equal(t, "reserved", statusDescription(0x09))
+}
@@ -0,0 +1,197 @@
+package smppclient
+
+import (
+	"math/rand"
+	"strings"
+	"time"
+
+	gometrics "github.com/armon/go-metrics"
+	"github.com/sirupsen/logrus"
+	"github.com/skill215/go-smpp/smpp"
+	"github.com/skill215/go-smpp/smpp/pdu"
+	"github.com/skill215/go-smpp/smpp/pdu/pdufield"
+	"github.com/skill215/go-smpp/smpp/pdu/pdutlv"
+	"github.com/skill215/smpp-app/coding"
+	"github.com/skill215/smpp-app/config"
+	"github.com/skill215/smpp-app/dlr"
+	msggenerator "github.com/skill215/smpp-app/msg-generator"
+)
+
+// concatenation methods of a message too long for one submit_sm
+const (
+	concatUDH8    = "udh8"
+	concatUDH16   = "udh16"
+	concatSAR     = "sar"
+	concatPayload = "payload"
+)
+
+// esmClassUDHI tells the user data starts with a header.
+const esmClassUDHI = 0x40
+
+// submitPDUs builds the submit_sm of a message. A text too long for one
+// is split by its data coding into parts concatenated with method, or sent
+// whole in message_payload. National language IEs go in the UDH of every
+// part.
+func submitPDUs(msg *msggenerator.Message, method string) []pdu.Body {
+	method = strings.ToLower(method)
+	sm := msg.ShortMessage
+	raw := sm.Text.Encode()
+	dcs := sm.Text.Type()
+	var ies []byte
+	if t, ok := sm.Text.(*coding.NationalText); ok {
+		ies = t.IEs()
+	}
+
+	if method == concatPayload || coding.Fits(dcs, raw, udhLen(ies, 0)) {
+		p := submitPDU(msg, esmClass(sm, ies, nil))
+		if method == concatPayload {
+			p.Fields().Set(pdufield.ShortMessage, []byte{})
+			p.TLVFields().Set(pdutlv.TagMessagePayload, userData(ies, nil, raw))
+		} else {
+			p.Fields().Set(pdufield.ShortMessage, userData(ies, nil, raw))
+		}
+		return []pdu.Body{p}
+	}
+
+	// length of the concatenation IE, SAR uses TLVs instead
+	concatLen := 0
+	switch method {
+	case concatUDH16:
+		concatLen = 6
+	case concatUDH8:
+		concatLen = 5
+	}
+	texts := coding.Split(dcs, raw, udhLen(ies, concatLen))
+	count := len(texts)
+	ref := uint16(rand.Intn(0xFFFF))
+	parts := make([]pdu.Body, 0, count)
+	for i, text := range texts {
+		var concat []byte
+		switch method {
+		case concatUDH16:
+			// CSMS 16 bit reference number, total and current part
+			concat = []byte{0x08, 0x04, uint8(ref >> 8), uint8(ref), uint8(count), uint8(i + 1)}
+		case concatUDH8:
+			// CSMS 8 bit reference number, total and current part
+			concat = []byte{0x00, 0x03, uint8(ref), uint8(count), uint8(i + 1)}
+		}
+		p := submitPDU(msg, esmClass(sm, ies, concat))
+		p.Fields().Set(pdufield.ShortMessage, userData(ies, concat, text))
+		if method == concatSAR {
+			p.TLVFields().Set(pdutlv.TagSarMsgRefNum, []byte{uint8(ref >> 8), uint8(ref)})
+			p.TLVFields().Set(pdutlv.TagSarTotalSegments, uint8(count))
+			p.TLVFields().Set(pdutlv.TagSarSegmentSeqnum, uint8(i+1))
+		}
+		parts = append(parts, p)
+	}
+	return parts
+}
+
+// udhLen returns the octets of a user data header with the given IEs, 0
+// without any.
+func udhLen(ies []byte, concatLen int) int {
+	if n := len(ies) + concatLen; n > 0 {
+		return 1 + n
+	}
+	return 0
+}
+
+// userData prepends the user data header of the IEs to text.
+func userData(ies, concat, text []byte) []byte {
+	n := len(ies) + len(concat)
+	if n == 0 {
+		return text
+	}
+	ud := make([]byte, 0, 1+n+len(text))
+	ud = append(ud, uint8(n)) // length of user data header
+	ud = append(ud, ies...)
+	ud = append(ud, concat...)
+	return append(ud, text...)
+}
+
+// esmClass sets UDHI on the esm_class of sm when there is a header.
+func esmClass(sm *smpp.ShortMessage, ies, concat []byte) uint8 {
+	if len(ies)+len(concat) > 0 {
+		return sm.ESMClass | esmClassUDHI
+	}
+	return sm.ESMClass
+}
+
+// submitPDU returns a submit_sm with every field of msg but the text.
+func submitPDU(msg *msggenerator.Message, esmClass uint8) pdu.Body {
+	sm := msg.ShortMessage
+	p := pdu.NewSubmitSM(sm.TLVFields)
+	f := p.Fields()
+	f.Set(pdufield.SourceAddr, sm.Src)
+	f.Set(pdufield.DestinationAddr, sm.Dst)
+	f.Set(pdufield.RegisteredDelivery, uint8(sm.Register))
+	switch {
+	case msg.ValidityPeriod != "":
+		f.Set(pdufield.ValidityPeriod, msg.ValidityPeriod)
+	case sm.Validity != 0:
+		// absolute time format YYMMDDhhmmsstnnp
+		f.Set(pdufield.ValidityPeriod, time.Now().UTC().Add(sm.Validity).Format("060102150405")+"000+")
+	}
+	f.Set(pdufield.ServiceType, sm.ServiceType)
+	f.Set(pdufield.SourceAddrTON, sm.SourceAddrTON)
+	f.Set(pdufield.SourceAddrNPI, sm.SourceAddrNPI)
+	f.Set(pdufield.DestAddrTON, sm.DestAddrTON)
+	f.Set(pdufield.DestAddrNPI, sm.DestAddrNPI)
+	f.Set(pdufield.ESMClass, esmClass)
+	f.Set(pdufield.ProtocolID, sm.ProtocolID)
+	f.Set(pdufield.PriorityFlag, sm.PriorityFlag)
+	f.Set(pdufield.ScheduleDeliveryTime, sm.ScheduleDeliveryTime)
+	f.Set(pdufield.ReplaceIfPresentFlag, sm.ReplaceIfPresentFlag)
+	f.Set(pdufield.SMDefaultMsgID, sm.SMDefaultMsgID)
+	f.Set(pdufield.DataCoding, uint8(sm.Text.Type()))
+	return p
+}
+
+// submitDone returns the callback counting the outcome of a submit_sm
+// sent on conn with the given message settings.
+func submitDone(conn *connection, log *logrus.Entry, inm *gometrics.InmemSink, tracker *dlr.Tracker, message *config.MessageConfig) func(pdu.Body, time.Duration, error) {
+	return func(resp pdu.Body, latency time.Duration, err error) {
+		if err != nil {
+			if err == ErrRespTimeout {
+				inm.IncrCounter([]string{"ao timeout"}, 1)
+				conn.metrics.timeouts.Inc()
+				log.WithError(err).Debug("Failed to submit message")
+				return
+			}
+			submitError(conn, inm, log, err)
+			return
+		}
+		inm.IncrCounter([]string{"ao"}, 1)
+		conn.metrics.response(latency)
+		if status := resp.Header().Status; status != 0 {
+			conn.metrics.failure(status)
+			log.WithFields(logrus.Fields{
+				"status": StatusName(status),
+				"desc":   status,
+			}).Debug("Message submission got non-zero status")
+			inm.IncrCounter([]string{"ao failure"}, 1)
+			// the sink keeps "." and turns spaces into "_", see metricName
+			inm.IncrCounter([]string{"ao failure", StatusName(status)}, 1)
+			if (status == statusThrottled || status == statusMsgQFull) && conn.throttled(status) {
+				inm.IncrCounter([]string{"ao backoff"}, 1)
+			}
+		} else if message.Send.RequireSR {
+			tracker.Submitted(respMessageID(resp), time.Now().Add(-latency), message.Send.ReceiptTimeout, conn.metrics.receiptLatency())
+		}
+	}
+}
+
+// submitted counts a message sent in the given number of submit_sm.
+func submitted(conn *connection, inm *gometrics.InmemSink, parts int) {
+	inm.IncrCounter([]string{"ao message"}, 1)
+	inm.IncrCounter([]string{"ao segment"}, float32(parts))
+	conn.metrics.messages.Inc()
+}
+
+// submitError counts a submit_sm lost on the transport, either not sent
+// because the connection was down or without response because it failed.
+func submitError(conn *connection, inm *gometrics.InmemSink, log *logrus.Entry, err error) {
+	inm.IncrCounter([]string{"ao error"}, 1)
+	conn.metrics.transportError()
+	log.WithError(err).Debug("Failed to submit message")
+}
@@ -0,0 +1,120 @@
+package smppclient
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/skill215/go-smpp/smpp"
+	"github.com/skill215/go-smpp/smpp/pdu"
+	"github.com/skill215/go-smpp/smpp/pdu/pdufield"
+	"github.com/skill215/go-smpp/smpp/pdu/pdutext"
+	"github.com/skill215/go-smpp/smpp/pdu/pdutlv"
+	"github.com/skill215/smpp-app/coding"
+	msggenerator "github.com/skill215/smpp-app/msg-generator"
+	"github.com/stretchr/testify/assert"
+)
+
+func message(text pdutext.Codec) *msggenerator.Message {
+	return &msggenerator.Message{ShortMessage: &smpp.ShortMessage{Text: text}}
+}
+
+func field(p pdu.Body, name pdufield.Name) []byte {
+	return p.Fields()[name].Bytes()
+}
+
+func TestSubmitSinglePart(t *testing.T) {
+	for _, text := range []pdutext.Codec{
+		pdutext.GSM7(strings.Repeat("a", 160)),
+		pdutext.Latin1(strings.Repeat("é", 140)),
+		pdutext.UCS2(strings.Repeat("好", 70)),
+	} {
+		parts := submitPDUs(message(text), concatUDH8)
+		assert.Len(t, parts, 1)
+		assert.Equal(t, []byte{0}, field(parts[0], pdufield.ESMClass))
+		assert.Equal(t, []byte{uint8(text.Type())}, field(parts[0], pdufield.DataCoding))
+	}
+}
+
+func TestSubmitUDH(t *testing.T) {
+	parts := submitPDUs(message(pdutext.UCS2(strings.Repeat("好", 71))), concatUDH8)
+	assert.Len(t, parts, 2)
+	for i, p := range parts {
+		ud := field(p, pdufield.ShortMessage)
+		assert.Equal(t, []byte{0x05, 0x00, 0x03}, ud[:3])
+		assert.Equal(t, []byte{2, uint8(i + 1)}, ud[4:6])
+		assert.Equal(t, []byte{esmClassUDHI}, field(p, pdufield.ESMClass))
+		assert.Equal(t, []byte{uint8(coding.UCS2)}, field(p, pdufield.DataCoding))
+	}
+	assert.Len(t, field(parts[0], pdufield.ShortMessage), 6+134)
+
+	parts = submitPDUs(message(pdutext.GSM7(strings.Repeat("a", 161))), concatUDH16)
+	assert.Len(t, parts, 2)
+	ud := field(parts[0], pdufield.ShortMessage)
+	assert.Equal(t, []byte{0x06, 0x08, 0x04}, ud[:3])
+	assert.Len(t, ud, 7+152)
+}
+
+func TestSubmitSAR(t *testing.T) {
+	parts := submitPDUs(message(pdutext.Latin1(strings.Repeat("é", 300))), concatSAR)
+	assert.Len(t, parts, 3)
+	ref := parts[0].TLVFields()[pdutlv.TagSarMsgRefNum].Bytes()
+	for i, p := range parts {
+		tlvs := p.TLVFields()
+		assert.Equal(t, ref, tlvs[pdutlv.TagSarMsgRefNum].Bytes())
+		assert.Equal(t, []byte{3}, tlvs[pdutlv.TagSarTotalSegments].Bytes())
+		assert.Equal(t, []byte{uint8(i + 1)}, tlvs[pdutlv.TagSarSegmentSeqnum].Bytes())
+		assert.Equal(t, []byte{0}, field(p, pdufield.ESMClass))
+	}
+	assert.Len(t, field(parts[0], pdufield.ShortMessage), 140)
+}
+
+func TestSubmitPayload(t *testing.T) {
+	text := pdutext.GSM7(strings.Repeat("a", 500))
+	parts := submitPDUs(message(text), concatPayload)
+	assert.Len(t, parts, 1)
+	assert.Empty(t, field(parts[0], pdufield.ShortMessage))
+	assert.Equal(t, text.Encode(), parts[0].TLVFields()[pdutlv.TagMessagePayload].Bytes())
+}
+
+func TestSubmitNational(t *testing.T) {
+	text := &coding.NationalText{Text: "Işık", Locking: coding.LanguageByName("turkish")}
+	parts := submitPDUs(message(text), concatUDH8)
+	assert.Len(t, parts, 1)
+	assert.Equal(t, []byte{esmClassUDHI}, field(parts[0], pdufield.ESMClass))
+	assert.Equal(t, append([]byte{0x03, coding.IELockingShift, 1, 1}, text.Encode()...), field(parts[0], pdufield.ShortMessage))
+
+	// the IEs come before the concatenation IE in every part
+	text.Text = strings.Repeat("ı", 200)
+	parts = submitPDUs(message(text), concatUDH8)
+	assert.Len(t, parts, 2)
+	ud := field(parts[1], pdufield.ShortMessage)
+	assert.Equal(t, []byte{0x08, coding.IELockingShift, 1, 1, 0x00, 0x03}, ud[:6])
+}
+
+func TestSubmitParams(t *testing.T) {
+	msg := message(pdutext.GSM7(strings.Repeat("a", 200)))
+	msg.ESMClass = 0x02
+	msg.ValidityPeriod = "000002000000000R"
+	msg.ScheduleDeliveryTime = "000000001000000R"
+	for _, p := range submitPDUs(msg, concatUDH8) {
+		// UDHI added to the configured esm_class
+		assert.Equal(t, []byte{0x42}, field(p, pdufield.ESMClass))
+		assert.Equal(t, "000002000000000R", p.Fields()[pdufield.ValidityPeriod].String())
+		assert.Equal(t, "000000001000000R", p.Fields()[pdufield.ScheduleDeliveryTime].String())
+	}
+}
+
+func TestSubmitTLVs(t *testing.T) {
+	msg := message(pdutext.Latin1(strings.Repeat("é", 200)))
+	msg.TLVFields = pdutlv.Fields{pdutlv.TagSourcePort: []byte{0x1F, 0x90}, 0x1400: []byte("x\x00")}
+	parts := submitPDUs(msg, concatSAR)
+	assert.Len(t, parts, 2)
+	for _, p := range parts {
+		tlvs := p.TLVFields()
+		assert.Equal(t, []byte{0x1F, 0x90}, tlvs[pdutlv.TagSourcePort].Bytes())
+		assert.Equal(t, []byte("x\x00"), tlvs[0x1400].Bytes())
+		assert.NotNil(t, tlvs[pdutlv.TagSarSegmentSeqnum])
+	}
+	// the SAR TLVs of one part are not on the message
+	assert.Len(t, msg.TLVFields, 2)
+}
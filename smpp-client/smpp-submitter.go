@@ -0,0 +1,201 @@
+package smppclient
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	gometrics "github.com/armon/go-metrics"
+	"github.com/sirupsen/logrus"
+	"github.com/skill215/go-smpp/smpp/pdu"
+	"github.com/skill215/smpp-app/config"
+	"github.com/skill215/smpp-app/dlr"
+	msggenerator "github.com/skill215/smpp-app/msg-generator"
+)
+
+// submitter is the part of a transmitter or transceiver group that sends:
+// its connections, each with a submit worker paced at its own rate, and
+// the message settings the submit_sm are generated from.
+type submitter struct {
+	sync.Mutex
+	log     *logrus.Logger
+	group   int // index in the config
+	conf    *config.SmppConfig
+	conns   []*connection
+	inm     *gometrics.InmemSink
+	tracker *dlr.Tracker
+	metrics *Metrics
+	cancel  context.CancelFunc
+	states  connStates
+	wg      sync.WaitGroup
+	// gets the deliver_sm and data_sm, nil on transmitters
+	handler func(c *connection, p pdu.Body)
+
+	// message settings, replaced in place by Update
+	msgLock      sync.RWMutex
+	message      *config.MessageConfig
+	msgGenerator *msggenerator.MsgGenerator
+}
+
+func newSubmitter(group int, conf config.SmppConfig, inm *gometrics.InmemSink, tracker *dlr.Tracker, metrics *Metrics, log *logrus.Logger) *submitter {
+	return &submitter{
+		log:     log,
+		group:   group,
+		conf:    &conf,
+		inm:     inm,
+		tracker: tracker,
+		metrics: metrics,
+	}
+}
+
+func (st *submitter) bind(ctx context.Context, conn *connection) {
+	conn.log.WithFields(logrus.Fields{
+		"conn_num": st.conf.Client.Count,
+		"window":   st.conf.Client.Window,
+	}).Info("Starting SMPP bind")
+
+	st.wg.Add(3)
+	// goroutine to bind and reconnect
+	go func() {
+		defer st.wg.Done()
+		conn.run(ctx)
+	}()
+
+	// go routine to recover from back-off
+	go func() {
+		defer st.wg.Done()
+		ticker := time.NewTicker(backoffTick(st.conf))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				conn.recover()
+			}
+		}
+	}()
+
+	// goroutine to submit sm, up to the window without waiting for responses
+	go func() {
+		defer st.wg.Done()
+		for {
+			// blocks while the rate is 0 until traffic is started
+			if err := conn.limiter.Wait(ctx); err != nil {
+				return
+			}
+			if conn.session() == nil || conn.isPaused() {
+				continue
+			}
+			msgGenerator, message := st.messageSettings()
+			// Generate a new message each time before sending
+			msg, err := msgGenerator.GenerateMsg()
+			if err != nil {
+				conn.log.WithError(err).Debug("Failed to generate message")
+				continue
+			}
+			done := submitDone(conn, conn.log.WithField("dst", msg.Dst), st.inm, st.tracker, message)
+			parts := submitPDUs(msg, message.Send.Concat)
+			if err := conn.submit(ctx, parts, done); err == nil {
+				submitted(conn, st.inm, len(parts))
+			} else if ctx.Err() == nil {
+				submitError(conn, st.inm, conn.log.WithFields(logrus.Fields{
+					"dst":            msg.Dst,
+					"content_length": len(msg.Text.Encode()),
+				}), err)
+			}
+		}
+	}()
+}
+
+// Start binds all connections of the group and launches their submit
+// workers, connection i at rates[i]. Calling Start on a running client is
+// a no-op.
+func (st *submitter) Start(rates []int) {
+	st.Lock()
+	defer st.Unlock()
+	if st.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	st.cancel = cancel
+	for i := 0; i < int(st.conf.Client.Count); i++ {
+		conn := newConnection(st.group, i, st.conf, &st.states, st.metrics, st.log, st.handler)
+		conn.pace(rates[i], st.conf)
+		st.conns = append(st.conns, conn)
+	}
+	st.states.reset(st.conns)
+	for _, conn := range st.conns {
+		st.bind(ctx, conn)
+	}
+}
+
+// Stop cancels the submit workers, waits for in-flight submits to finish
+// and unbinds every connection. The client can be started again afterwards.
+func (st *submitter) Stop() {
+	st.Lock()
+	defer st.Unlock()
+	if st.cancel == nil {
+		return
+	}
+
+	st.cancel()
+	st.wg.Wait()
+	st.log.WithField("conn_num", len(st.conns)).Infof("SMPP %s stopped", strings.ToLower(st.conf.Client.Type))
+	st.conns = nil
+	st.cancel = nil
+	st.states.reset(nil)
+}
+
+// SetRates sets the rate of every connection, a back-off in progress is
+// kept. It is a no-op while the client is stopped.
+func (st *submitter) SetRates(rates []int) {
+	st.Lock()
+	defer st.Unlock()
+	for i, conn := range st.conns {
+		if i < len(rates) {
+			conn.setTps(rates[i])
+		}
+	}
+}
+
+// State returns the bind state of every connection, empty when stopped.
+func (st *submitter) State() []ConnState {
+	return st.states.list()
+}
+
+// Control applies a manual action to connection conn, to all of them with
+// -1.
+func (st *submitter) Control(conn int, action string) error {
+	return st.states.control(conn, action)
+}
+
+// Update applies the message settings of conf in place, the connections
+// are left untouched.
+func (st *submitter) Update(conf config.SmppConfig) {
+	message := conf.Message
+	msgGenerator := msggenerator.New(&message)
+	st.msgLock.Lock()
+	defer st.msgLock.Unlock()
+	if st.msgGenerator != nil {
+		// a recipient list starts over with the new settings
+		st.msgGenerator.Close()
+	}
+	st.message = &message
+	st.msgGenerator = msgGenerator
+}
+
+// Recipients returns how much of the recipient list was used, nil unless
+// the group sends to a csv file.
+func (st *submitter) Recipients() *msggenerator.RecipientProgress {
+	msgGenerator, _ := st.messageSettings()
+	return msgGenerator.Recipients()
+}
+
+func (st *submitter) messageSettings() (*msggenerator.MsgGenerator, *config.MessageConfig) {
+	st.msgLock.RLock()
+	defer st.msgLock.RUnlock()
+	return st.msgGenerator, st.message
+}
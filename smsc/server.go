@@ -0,0 +1,318 @@
+package smsc
+
+import (
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/skill215/go-smpp/smpp/pdu"
+	"github.com/skill215/go-smpp/smpp/pdu/pdufield"
+	"github.com/skill215/smpp-app/config"
+	"github.com/skill215/smpp-app/dlr"
+)
+
+const (
+	SystemID = "smpp-app-smsc"
+
+	statusSysErr    = pdu.Status(0x08)
+	statusThrottled = pdu.Status(0x58)
+)
+
+// Server is a mock SMSC. It accepts binds, answers submit_sm with the
+// configured latency and error mix, generates delivery receipts and pushes
+// MO deliver_sm to the receiving binds.
+type Server struct {
+	log   *logrus.Logger
+	conf  config.SmscConfig
+	l     net.Listener
+	msgID uint64
+	stop  chan struct{}
+
+	mu       sync.Mutex
+	rnd      *rand.Rand
+	sessions map[*session]struct{}
+	moNext   int
+}
+
+func New(conf config.SmscConfig, log *logrus.Logger) *Server {
+	return &Server{
+		log:      log,
+		conf:     conf,
+		stop:     make(chan struct{}),
+		rnd:      rand.New(rand.NewSource(time.Now().UnixNano())),
+		sessions: map[*session]struct{}{},
+	}
+}
+
+// Listen opens the listener, use port 0 for a random port.
+func (s *Server) Listen(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	s.l = l
+	return nil
+}
+
+// Addr returns the listener address, or empty before Listen.
+func (s *Server) Addr() string {
+	if s.l == nil {
+		return ""
+	}
+	return s.l.Addr().String()
+}
+
+// Serve accepts binds until Close is called.
+func (s *Server) Serve() {
+	s.log.WithField("addr", s.Addr()).Info("Mock SMSC listening")
+	if s.conf.Mo.Tps > 0 {
+		go s.pushMO()
+	}
+	for {
+		conn, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+		c := newSession(s, conn)
+		s.mu.Lock()
+		s.sessions[c] = struct{}{}
+		s.mu.Unlock()
+		go c.serve()
+	}
+}
+
+// Close stops accepting binds and drops every session.
+func (s *Server) Close() {
+	close(s.stop)
+	s.l.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.sessions {
+		c.conn.Close()
+	}
+}
+
+// Unbind sends unbind to every bound session, each closes once the ESME
+// answers.
+func (s *Server) Unbind() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.sessions {
+		if c.bound() != 0 {
+			c.write(pdu.NewUnbind())
+		}
+	}
+}
+
+// Sessions returns the number of open sessions, bound or not.
+func (s *Server) Sessions() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sessions)
+}
+
+func (s *Server) remove(c *session) {
+	s.mu.Lock()
+	delete(s.sessions, c)
+	s.mu.Unlock()
+}
+
+// auth checks the bind credentials and returns the bind_resp status.
+func (s *Server) auth(user, password string) pdu.Status {
+	if len(s.conf.Users) == 0 {
+		return 0
+	}
+	for _, u := range s.conf.Users {
+		if u.User != user {
+			continue
+		}
+		if u.Password != password {
+			return 0x0e // ESME_RINVPASWD
+		}
+		return 0
+	}
+	return 0x0f // ESME_RINVSYSID
+}
+
+func (s *Server) nextMsgID() string {
+	return strconv.FormatUint(atomic.AddUint64(&s.msgID, 1), 10)
+}
+
+func (s *Server) latency() time.Duration {
+	d := s.conf.Submit.Latency
+	if j := s.conf.Submit.LatencyJitter; j > 0 {
+		s.mu.Lock()
+		d += time.Duration(s.rnd.Int63n(int64(j)))
+		s.mu.Unlock()
+	}
+	return d
+}
+
+// submitError picks the error status for a submit_sm, or 0 for success.
+func (s *Server) submitError() pdu.Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conf.Submit.ErrorRate <= 0 || s.rnd.Float64() >= s.conf.Submit.ErrorRate {
+		return 0
+	}
+	codes := s.conf.Submit.ErrorCodes
+	if len(codes) == 0 {
+		return statusSysErr
+	}
+	weights := make([]int, len(codes))
+	for i, c := range codes {
+		weights[i] = c.Weight
+	}
+	return pdu.Status(codes[pick(s.rnd, weights)].Status)
+}
+
+// receiptState picks the final state of a delivery receipt.
+func (s *Server) receiptState() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	states := s.conf.Receipt.States
+	if len(states) == 0 {
+		return "DELIVRD"
+	}
+	weights := make([]int, len(states))
+	for i, st := range states {
+		weights[i] = st.Weight
+	}
+	return states[pick(s.rnd, weights)].State
+}
+
+// receiver returns a bind that takes deliver_sm for system_id, c itself if
+// it is a transceiver.
+func (s *Server) receiver(c *session) *session {
+	if c.receives() {
+		return c
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for r := range s.sessions {
+		if r.receives() && r.systemID == c.systemID {
+			return r
+		}
+	}
+	return nil
+}
+
+// scheduleReceipt sends the delivery receipt of an accepted submit_sm
+// after the configured delay, if the submit_sm asked for one.
+func (s *Server) scheduleReceipt(c *session, p pdu.Body, id string, submitted time.Time) {
+	f := p.Fields()
+	rd := f[pdufield.RegisteredDelivery]
+	if !s.conf.Receipt.Enable || rd == nil || rd.Bytes()[0]&0x03 == 0 {
+		return
+	}
+	state := s.receiptState()
+	// registered_delivery 2 only asks for failure receipts
+	if rd.Bytes()[0]&0x03 == 0x02 && state == "DELIVRD" {
+		return
+	}
+	time.AfterFunc(s.conf.Receipt.Delay, func() {
+		r := s.receiver(c)
+		if r == nil {
+			s.log.WithFields(logrus.Fields{
+				"id":        id,
+				"system_id": c.systemID,
+			}).Debug("No receiving bind for delivery receipt")
+			return
+		}
+		receipt := &dlr.Receipt{
+			ID:         id,
+			Sub:        1,
+			SubmitDate: submitted,
+			DoneDate:   time.Now(),
+			Stat:       state,
+			Err:        "000",
+			Text:       receiptText(p),
+		}
+		if state == "DELIVRD" {
+			receipt.Dlvrd = 1
+		} else {
+			receipt.Err = "001"
+		}
+		if err := r.write(dlr.NewDeliverSM(receipt, field(f, pdufield.DestinationAddr), field(f, pdufield.SourceAddr))); err != nil {
+			s.log.WithError(err).Debug("Failed to send delivery receipt")
+		}
+	})
+}
+
+// pushMO sends MO deliver_sm round-robin to the receiving binds.
+func (s *Server) pushMO() {
+	ticker := time.NewTicker(time.Second / time.Duration(s.conf.Mo.Tps))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+		s.mu.Lock()
+		receivers := []*session{}
+		for c := range s.sessions {
+			if c.receives() {
+				receivers = append(receivers, c)
+			}
+		}
+		var r *session
+		if len(receivers) > 0 {
+			s.moNext = (s.moNext + 1) % len(receivers)
+			r = receivers[s.moNext]
+		}
+		s.mu.Unlock()
+		if r == nil {
+			continue
+		}
+
+		p := pdu.NewDeliverSM()
+		f := p.Fields()
+		f.Set(pdufield.SourceAddr, s.conf.Mo.Src)
+		f.Set(pdufield.DestinationAddr, s.conf.Mo.Dst)
+		f.Set(pdufield.ShortMessage, s.conf.Mo.Text)
+		if err := r.write(p); err != nil {
+			s.log.WithError(err).Debug("Failed to send MO message")
+		}
+	}
+}
+
+// receiptText returns the first 20 characters of a GSM7/ASCII message.
+func receiptText(p pdu.Body) string {
+	dc := p.Fields()[pdufield.DataCoding]
+	sm := p.Fields()[pdufield.ShortMessage]
+	if sm == nil || (dc != nil && dc.Bytes()[0] != 0) {
+		return ""
+	}
+	text := sm.Bytes()
+	if len(text) > 20 {
+		text = text[:20]
+	}
+	return string(text)
+}
+
+// pick returns an index chosen by weight, weights below 1 count as 1.
+func pick(rnd *rand.Rand, weights []int) int {
+	total := 0
+	for _, w := range weights {
+		if w < 1 {
+			w = 1
+		}
+		total += w
+	}
+	n := rnd.Intn(total)
+	for i, w := range weights {
+		if w < 1 {
+			w = 1
+		}
+		if n < w {
+			return i
+		}
+		n -= w
+	}
+	return len(weights) - 1
+}
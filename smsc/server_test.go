@@ -0,0 +1,117 @@
+package smsc_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/skill215/go-smpp/smpp"
+	"github.com/skill215/go-smpp/smpp/pdu"
+	"github.com/skill215/go-smpp/smpp/pdu/pdufield"
+	"github.com/skill215/go-smpp/smpp/pdu/pdutext"
+	"github.com/skill215/smpp-app/config"
+	"github.com/skill215/smpp-app/dlr"
+	"github.com/skill215/smpp-app/smsc"
+	"github.com/stretchr/testify/assert"
+)
+
+func startServer(t *testing.T, conf config.SmscConfig) *smsc.Server {
+	srv := smsc.New(conf, logrus.New())
+	if err := srv.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func bind(t *testing.T, tc *smpp.Transceiver) {
+	select {
+	case status := <-tc.Bind():
+		if status.Status() != smpp.Connected {
+			t.Fatalf("bind failed: %v", status.Error())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("bind timeout")
+	}
+	t.Cleanup(func() { tc.Close() })
+}
+
+func TestSubmitWithReceipt(t *testing.T) {
+	conf := config.SmscConfig{}
+	conf.Receipt.Enable = true
+	srv := startServer(t, conf)
+
+	receipts := make(chan *dlr.Receipt, 1)
+	tc := &smpp.Transceiver{
+		Addr: srv.Addr(),
+		User: "user",
+		Handler: func(p pdu.Body) {
+			if r, err := dlr.Parse(p); err == nil {
+				receipts <- r
+			}
+		},
+	}
+	bind(t, tc)
+
+	sm, err := tc.Submit(&smpp.ShortMessage{
+		Src:      "1234",
+		Dst:      "5678",
+		Text:     pdutext.Raw("hello"),
+		Register: pdufield.FinalDeliveryReceipt,
+	})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, sm.RespID())
+
+	select {
+	case r := <-receipts:
+		assert.Equal(t, sm.RespID(), r.MessageID())
+		assert.Equal(t, "DELIVRD", r.State())
+		assert.Equal(t, "hello", r.Text)
+	case <-time.After(time.Second):
+		t.Fatal("no delivery receipt")
+	}
+}
+
+func TestSubmitErrors(t *testing.T) {
+	conf := config.SmscConfig{}
+	conf.Submit.ErrorRate = 1
+	conf.Submit.ErrorCodes = []config.SmscErrorCode{{Status: 0x0b}}
+	srv := startServer(t, conf)
+
+	tc := &smpp.Transceiver{Addr: srv.Addr(), User: "user"}
+	bind(t, tc)
+
+	_, err := tc.Submit(&smpp.ShortMessage{Dst: "5678", Text: pdutext.Raw("hello")})
+	assert.Equal(t, pdu.Status(0x0b), err)
+}
+
+func TestSubmitThrottled(t *testing.T) {
+	conf := config.SmscConfig{}
+	conf.Submit.ThrottleTps = 1
+	srv := startServer(t, conf)
+
+	tc := &smpp.Transceiver{Addr: srv.Addr(), User: "user"}
+	bind(t, tc)
+
+	_, err := tc.Submit(&smpp.ShortMessage{Dst: "5678", Text: pdutext.Raw("hello")})
+	assert.Nil(t, err)
+	_, err = tc.Submit(&smpp.ShortMessage{Dst: "5678", Text: pdutext.Raw("hello")})
+	assert.Equal(t, pdu.Status(0x58), err)
+}
+
+func TestBindRejected(t *testing.T) {
+	conf := config.SmscConfig{}
+	conf.Users = []config.SmscUser{{User: "user", Password: "secret"}}
+	srv := startServer(t, conf)
+
+	tc := &smpp.Transceiver{Addr: srv.Addr(), User: "user", Passwd: "wrong"}
+	defer tc.Close()
+	select {
+	case status := <-tc.Bind():
+		assert.Equal(t, smpp.BindFailed, status.Status())
+		assert.Equal(t, pdu.Status(0x0e), status.Error())
+	case <-time.After(time.Second):
+		t.Fatal("bind timeout")
+	}
+}
@@ -0,0 +1,202 @@
+package smsc
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/skill215/go-smpp/smpp/pdu"
+	"github.com/skill215/go-smpp/smpp/pdu/pdufield"
+)
+
+// session is one bind of an ESME to the mock SMSC.
+type session struct {
+	srv      *Server
+	conn     net.Conn
+	r        *bufio.Reader
+	systemID string
+	// bind command id once bound, read from other goroutines
+	bindID uint32
+
+	wmu sync.Mutex
+	w   *bufio.Writer
+
+	// submit_sm count of the current second, for throttling
+	windowBegin time.Time
+	windowCount int
+}
+
+func newSession(srv *Server, conn net.Conn) *session {
+	return &session{
+		srv:  srv,
+		conn: conn,
+		r:    bufio.NewReader(conn),
+		w:    bufio.NewWriter(conn),
+	}
+}
+
+func (c *session) bound() pdu.ID {
+	return pdu.ID(atomic.LoadUint32(&c.bindID))
+}
+
+// receives reports whether the bind takes deliver_sm.
+func (c *session) receives() bool {
+	id := c.bound()
+	return id == pdu.BindReceiverID || id == pdu.BindTransceiverID
+}
+
+func (c *session) write(p pdu.Body) error {
+	var b bytes.Buffer
+	if err := p.SerializeTo(&b); err != nil {
+		return err
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if _, err := c.w.Write(b.Bytes()); err != nil {
+		return err
+	}
+	return c.w.Flush()
+}
+
+func (c *session) serve() {
+	defer c.srv.remove(c)
+	defer c.conn.Close()
+	log := c.srv.log.WithField("remote", c.conn.RemoteAddr().String())
+	for {
+		p, err := pdu.Decode(c.r)
+		if err != nil {
+			if err != io.EOF {
+				log.WithError(err).Debug("Mock SMSC read failed")
+			}
+			return
+		}
+		seq := p.Header().Seq
+		switch p.Header().ID {
+		case pdu.BindTransmitterID, pdu.BindReceiverID, pdu.BindTransceiverID:
+			if !c.bind(p) {
+				return
+			}
+		case pdu.EnquireLinkID:
+			c.write(pdu.NewEnquireLinkRespSeq(seq))
+		case pdu.UnbindID:
+			resp := pdu.NewUnbindResp()
+			resp.Header().Seq = seq
+			c.write(resp)
+			log.WithField("system_id", c.systemID).Debug("Mock SMSC unbind")
+			return
+		case pdu.SubmitSMID:
+			c.submit(p)
+		case pdu.UnbindRespID:
+			log.WithField("system_id", c.systemID).Debug("Mock SMSC unbound the session")
+			return
+		case pdu.DeliverSMRespID, pdu.EnquireLinkRespID:
+		default:
+			nack := pdu.NewGenericNACK()
+			nack.Header().Seq = seq
+			nack.Header().Status = 0x03 // ESME_RINVCMDID
+			c.write(nack)
+		}
+	}
+}
+
+// bind answers a bind request and reports whether the session stays open.
+func (c *session) bind(p pdu.Body) bool {
+	var resp pdu.Body
+	switch p.Header().ID {
+	case pdu.BindTransmitterID:
+		resp = pdu.NewBindTransmitterResp()
+	case pdu.BindReceiverID:
+		resp = pdu.NewBindReceiverResp()
+	default:
+		resp = pdu.NewBindTransceiverResp()
+	}
+	resp.Header().Seq = p.Header().Seq
+	resp.Fields().Set(pdufield.SystemID, SystemID)
+
+	f := p.Fields()
+	user, password := field(f, pdufield.SystemID), field(f, pdufield.Password)
+	status := c.srv.auth(user, password)
+	if c.bound() != 0 {
+		status = 0x05 // ESME_RALYBND
+	}
+	resp.Header().Status = status
+	c.write(resp)
+
+	log := c.srv.log.WithFields(logrus.Fields{
+		"remote":    c.conn.RemoteAddr().String(),
+		"system_id": user,
+		"bind":      p.Header().ID.String(),
+	})
+	if status != 0 {
+		log.WithField("status", status.Error()).Warn("Mock SMSC rejected bind")
+		return status == 0x05
+	}
+	c.systemID = user
+	atomic.StoreUint32(&c.bindID, uint32(p.Header().ID))
+	log.Info("Mock SMSC bind accepted")
+	return true
+}
+
+// submit answers a submit_sm after the configured latency.
+func (c *session) submit(p pdu.Body) {
+	now := time.Now()
+	resp := pdu.NewSubmitSMResp()
+	resp.Header().Seq = p.Header().Seq
+
+	var status pdu.Status
+	switch c.bound() {
+	case pdu.BindTransmitterID, pdu.BindTransceiverID:
+		status = c.throttle(now)
+		if status == 0 {
+			status = c.srv.submitError()
+		}
+	default:
+		status = 0x04 // ESME_RINVBNDSTS
+	}
+	resp.Header().Status = status
+
+	id := ""
+	if status == 0 {
+		id = c.srv.nextMsgID()
+		resp.Fields().Set(pdufield.MessageID, id)
+	}
+	time.AfterFunc(c.srv.latency(), func() {
+		if err := c.write(resp); err != nil {
+			return
+		}
+		if status == 0 {
+			c.srv.scheduleReceipt(c, p, id, now)
+		}
+	})
+}
+
+// throttle returns ESME_RTHROTTLED once the bind exceeds throttle-tps
+// within the current second.
+func (c *session) throttle(now time.Time) pdu.Status {
+	limit := c.srv.conf.Submit.ThrottleTps
+	if limit <= 0 {
+		return 0
+	}
+	if now.Sub(c.windowBegin) >= time.Second {
+		c.windowBegin = now
+		c.windowCount = 0
+	}
+	c.windowCount++
+	if c.windowCount > limit {
+		return statusThrottled
+	}
+	return 0
+}
+
+// field returns the string value of a PDU field, or empty if missing.
+func field(f pdufield.Map, name pdufield.Name) string {
+	if v := f[name]; v != nil {
+		return v.String()
+	}
+	return ""
+}
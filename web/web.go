@@ -0,0 +1,21 @@
+// Package web embeds the single page GUI served by the REST server.
+package web
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed static
+var static embed.FS
+
+// Handler serves the GUI, index.html at "/". The page only talks to the
+// /api endpoints of the REST server.
+func Handler() http.Handler {
+	sub, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err)
+	}
+	return http.FileServer(http.FS(sub))
+}